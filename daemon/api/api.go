@@ -0,0 +1,246 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/coltwillcox/ngn/daemon/control"
+	"github.com/coltwillcox/ngn/daemon/media"
+	"github.com/coltwillcox/ngn/protocol"
+)
+
+const (
+	tokenName        = "ngn-api.token"
+	tokenLength      = 32
+	maximumBodySize  = 1 << 20
+	timeHeader       = 5 // Seconds.
+	statusFailed     = "failed"
+	unixSocketPrefix = "unix:"
+)
+
+// Request is JSON body of a pushed notification.
+type Request struct {
+	Program  string `json:"program"`
+	Title    string `json:"title"`
+	Body     string `json:"body"`
+	Icon     string `json:"icon"`      // Base64 encoded image file (PNG, JPEG or SVG).
+	IconPath string `json:"icon_path"` // Path to image file, used if Icon is empty.
+	Urgency  string `json:"urgency"`   // low, normal or critical.
+	Color    string `json:"color"`     // LED color as hex RGB, e.g. "#ff0000".
+	Sticky   bool   `json:"sticky"`    // Pinned in badge history, critical notifications always are.
+}
+
+// Response reports delivery status of a notification.
+type Response struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Server is a small HTTP API, on localhost or Unix socket, for pushing custom notifications to the badge.
+type Server struct {
+	server   *http.Server
+	token    string
+	requests chan<- control.Request
+}
+
+// TokenPath returns location of the file with API token inside control.RuntimeDir.
+func TokenPath() (string, error) {
+	dir, err := control.RuntimeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, tokenName), nil
+}
+
+// LoadToken reads API token, creating a random one on the first run or if the file is empty.
+// Token file which others can read or replace is refused.
+func LoadToken(path string) (string, error) {
+	if data, err := os.ReadFile(path); err == nil {
+		if err := control.CheckPrivate(path, 0600); err != nil {
+			return "", err
+		}
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, nil
+		}
+	}
+
+	data := make([]byte, tokenLength)
+	if _, err := rand.Read(data); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := hex.EncodeToString(data)
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to save token: %w", err)
+	}
+
+	return token, nil
+}
+
+// Listen starts API on address, either "unix:/path/to/socket" or loopback "host:port".
+// Accepted notifications are passed to requests channel.
+func Listen(address, token string, requests chan<- control.Request) (*Server, error) {
+	listener, err := listen(address)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		token:    token,
+		requests: requests,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /notifications", s.authorized(s.handleNotification))
+	mux.HandleFunc("GET /status", s.authorized(s.handleStatus))
+	s.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: timeHeader * time.Second,
+	}
+
+	go s.server.Serve(listener)
+
+	return s, nil
+}
+
+func (s *Server) Close() error {
+	return s.server.Shutdown(context.Background())
+}
+
+func listen(address string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(address, unixSocketPrefix); ok {
+		if err := control.RemoveStale(path); err != nil {
+			return nil, err
+		}
+		listener, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on socket: %w", err)
+		}
+		if err := os.Chmod(path, 0600); err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+		}
+		return listener, nil
+	}
+
+	return control.ListenLoopback(address)
+}
+
+func (s *Server) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		// Empty token would let in requests without any.
+		if !ok || s.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			respond(w, http.StatusUnauthorized, Response{Status: statusFailed, Error: "unauthorized"})
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func (s *Server) handleNotification(w http.ResponseWriter, r *http.Request) {
+	request := Request{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maximumBodySize)).Decode(&request); err != nil {
+		respond(w, http.StatusBadRequest, Response{Status: statusFailed, Error: "invalid JSON: " + err.Error()})
+		return
+	}
+
+	badgeNotification, err := ToNotification(request)
+	if err != nil {
+		respond(w, http.StatusBadRequest, Response{Status: statusFailed, Error: err.Error()})
+		return
+	}
+
+	reply := control.Execute(s.requests, control.Request{Command: control.CommandSend, Notification: &badgeNotification})
+	switch {
+	case reply.Err == nil && reply.Message == control.ReplyCoalesced:
+		respond(w, http.StatusAccepted, Response{Status: control.ReplyCoalesced})
+	case reply.Err == nil:
+		respond(w, http.StatusOK, Response{Status: control.ReplySent})
+	case errors.Is(reply.Err, control.ErrDropped):
+		respond(w, http.StatusTooManyRequests, Response{Status: statusFailed, Error: reply.Err.Error()})
+	case errors.Is(reply.Err, control.ErrTimeout):
+		respond(w, http.StatusGatewayTimeout, Response{Status: statusFailed, Error: reply.Err.Error()})
+	default:
+		respond(w, http.StatusServiceUnavailable, Response{Status: statusFailed, Error: reply.Err.Error()})
+	}
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	reply := control.Execute(s.requests, control.Request{Command: control.CommandStatus})
+	if reply.Err != nil {
+		respond(w, http.StatusGatewayTimeout, Response{Status: statusFailed, Error: reply.Err.Error()})
+		return
+	}
+	respond(w, http.StatusOK, Response{Status: reply.Message})
+}
+
+// ToNotification validates request and converts it to notification ready to be sent, with icon already generated.
+func ToNotification(request Request) (protocol.Notification, error) {
+	if request.Title == "" && request.Body == "" {
+		return protocol.Notification{}, errors.New("title or body required")
+	}
+
+	urgency := strings.ToLower(request.Urgency)
+	switch urgency {
+	case "":
+		urgency = protocol.UrgencyNormal
+	case protocol.UrgencyLow, protocol.UrgencyNormal, protocol.UrgencyCritical:
+	default:
+		return protocol.Notification{}, fmt.Errorf("invalid urgency %q", request.Urgency)
+	}
+
+	color := strings.ToLower(strings.TrimPrefix(request.Color, "#"))
+	if _, err := hex.DecodeString(color); err != nil || (color != "" && len(color) != 6) {
+		return protocol.Notification{}, fmt.Errorf("invalid color %q", request.Color)
+	}
+
+	fallback := media.FallbackLetter(request.Program)
+	icon := ""
+	switch {
+	case request.Icon != "":
+		iconData, err := base64.StdEncoding.DecodeString(request.Icon)
+		if err != nil {
+			return protocol.Notification{}, fmt.Errorf("invalid icon: %w", err)
+		}
+		if icon, err = media.GenerateImageDataFromBytes(iconData, fallback); err != nil {
+			return protocol.Notification{}, fmt.Errorf("invalid icon: %w", err)
+		}
+	case request.IconPath != "":
+		var err error
+		if icon, err = media.GenerateImageData(request.IconPath, fallback); err != nil {
+			return protocol.Notification{}, fmt.Errorf("invalid icon: %w", err)
+		}
+	}
+
+	sticky := ""
+	if request.Sticky {
+		sticky = protocol.StickyTrue
+	}
+
+	return protocol.Notification{
+		Program: request.Program,
+		Title:   request.Title,
+		Body:    request.Body,
+		Icon:    icon,
+		Urgency: urgency,
+		Sticky:  sticky,
+		Color:   color,
+	}, nil
+}
+
+func respond(w http.ResponseWriter, status int, response Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"go.bug.st/serial"
+
+	"github.com/coltwillcox/ngn/daemon/api"
+	"github.com/coltwillcox/ngn/daemon/control"
+	"github.com/coltwillcox/ngn/protocol"
+)
+
+const (
+	commandDaemon = "daemon"
+	commandSend   = "send"
+	commandCtl    = "ctl"
+	commandHelp   = "help"
+)
+
+func usage(w io.Writer) {
+	fmt.Fprint(w, `Usage: ngn <command> [flags]
+
+Commands:
+  daemon    run daemon, listening for notifications (default)
+  send      send notification to the badge
+  ctl       control running daemon: pause, resume, clear, status, history, devices or exit
+  help      show this help
+
+Run "ngn <command> -h" for command flags.
+`)
+}
+
+// runSend passes notification to running daemon, or directly to the badge if daemon is not running.
+func runSend(args []string) int {
+	request := api.Request{}
+	flags := flag.NewFlagSet(commandSend, flag.ExitOnError)
+	flags.StringVar(&request.Program, "program", "ngn", "application name")
+	flags.StringVar(&request.Title, "title", "", "notification title")
+	flags.StringVar(&request.Body, "body", "", "notification body")
+	flags.StringVar(&request.IconPath, "icon", "", "path to icon (PNG, JPEG or SVG)")
+	flags.StringVar(&request.Urgency, "urgency", protocol.UrgencyNormal, "low, normal or critical")
+	flags.StringVar(&request.Color, "color", "", "LED color as hex RGB, e.g. \"#ff0000\"")
+	flags.BoolVar(&request.Sticky, "sticky", false, "keep pinned in badge history (critical notifications always are)")
+	flags.Parse(args)
+
+	badgeNotification, err := api.ToNotification(request)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	badgeNotification.CreatedAt = time.Now().Format(protocol.TimeFormat)
+
+	socketPath, err := control.SocketPath()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	reply, err := control.Send(socketPath, control.Request{Command: control.CommandSend, Notification: &badgeNotification})
+	if errors.Is(err, control.ErrNotRunning) {
+		// Generated here, sendNotification logs failure only in daemon.
+		if badgeNotification.Icon == "" {
+			icon, err := generateIcon(badgeNotification.IconPath, badgeNotification.Program)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			badgeNotification.Icon = icon
+		}
+		err = withPort(func(port serial.Port) error {
+			_, err := sendNotification(port, badgeNotification)
+			return err
+		})
+		reply = control.ReplySent
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Println(reply)
+	return 0
+}
+
+// runCtl passes command to running daemon. Clearing works directly with the badge if daemon is not running.
+func runCtl(args []string) int {
+	flags := flag.NewFlagSet(commandCtl, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ngn ctl pause|resume|clear|status|history|devices|exit")
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	command, err := control.ParseCommand(flags.Arg(0))
+	if err != nil || command == control.CommandSend {
+		flags.Usage()
+		return 2
+	}
+
+	socketPath, err := control.SocketPath()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	reply, err := control.Send(socketPath, control.Request{Command: command})
+	if errors.Is(err, control.ErrNotRunning) && command == control.CommandClear {
+		err = withPort(func(port serial.Port) error {
+			if _, err := port.Write(protocol.AppendCommand(nil, protocol.CommandClear)); err != nil {
+				return err
+			}
+			// Give some time to Gopher Badge to process message.
+			time.Sleep(timeSender * time.Millisecond)
+			return nil
+		})
+		reply = "ok"
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Println(reply)
+	return 0
+}
+
+// withPort opens badge port for a single operation, used when daemon is not running.
+func withPort(operation func(port serial.Port) error) error {
+	port, err := serial.Open(badgePort, &serial.Mode{})
+	if err != nil {
+		return fmt.Errorf("daemon not running and failed to open port: %w", err)
+	}
+	defer port.Close()
+	capabilities = handshake(port)
+
+	return operation(port)
+}
@@ -0,0 +1,141 @@
+package control
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+
+	"github.com/coltwillcox/ngn/protocol"
+)
+
+const (
+	busName             = "org.ngn.Daemon"
+	busPath             = "/org/ngn/Daemon"
+	busError            = busName + ".Error"
+	signalConnection    = busName + ".ConnectionChanged"
+	signalPaused        = busName + ".PausedChanged"
+	introspectInterface = `
+	<interface name="` + busName + `">
+		<method name="Pause"/>
+		<method name="Resume"/>
+		<method name="Clear"/>
+		<method name="Send">
+			<arg name="program" type="s" direction="in"/>
+			<arg name="title" type="s" direction="in"/>
+			<arg name="body" type="s" direction="in"/>
+		</method>
+		<method name="GetStatus">
+			<arg name="status" type="s" direction="out"/>
+		</method>
+		<method name="ListDevices">
+			<arg name="devices" type="as" direction="out"/>
+		</method>
+		<signal name="ConnectionChanged">
+			<arg name="connected" type="b"/>
+		</signal>
+		<signal name="PausedChanged">
+			<arg name="paused" type="b"/>
+		</signal>
+	</interface>`
+)
+
+// Bus exports "org.ngn.Daemon" object on session bus, so daemon can be scripted
+// from keybindings, scripts and status bars.
+type Bus struct {
+	conn     *dbus.Conn
+	requests chan<- Request
+}
+
+// ExportBus claims daemon bus name, called methods are passed to requests channel.
+func ExportBus(requests chan<- Request) (*Bus, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to session bus: %w", err)
+	}
+
+	bus := &Bus{
+		conn:     conn,
+		requests: requests,
+	}
+
+	if err := conn.Export(bus, busPath, busName); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to export daemon: %w", err)
+	}
+	introspectable := introspect.Introspectable(`<node>` + introspect.IntrospectDataString + introspectInterface + `</node>`)
+	if err := conn.Export(introspectable, busPath, "org.freedesktop.DBus.Introspectable"); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to export introspection: %w", err)
+	}
+
+	reply, err := conn.RequestName(busName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to request name: %w", err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		conn.Close()
+		return nil, fmt.Errorf("%s already owned by other daemon", busName)
+	}
+
+	return bus, nil
+}
+
+func (b *Bus) Close() error {
+	return b.conn.Close()
+}
+
+// EmitConnection notifies subscribers that badge got connected or disconnected.
+func (b *Bus) EmitConnection(connected bool) error {
+	return b.conn.Emit(busPath, signalConnection, connected)
+}
+
+// EmitPaused notifies subscribers that transmitting got paused or resumed.
+func (b *Bus) EmitPaused(paused bool) error {
+	return b.conn.Emit(busPath, signalPaused, paused)
+}
+
+func (b *Bus) Pause() *dbus.Error {
+	return b.call(Request{Command: CommandPause}).err()
+}
+
+func (b *Bus) Resume() *dbus.Error {
+	return b.call(Request{Command: CommandResume}).err()
+}
+
+func (b *Bus) Clear() *dbus.Error {
+	return b.call(Request{Command: CommandClear}).err()
+}
+
+func (b *Bus) Send(program, title, body string) *dbus.Error {
+	return b.call(Request{
+		Command:      CommandSend,
+		Notification: &protocol.Notification{Program: program, Title: title, Body: body},
+	}).err()
+}
+
+func (b *Bus) GetStatus() (string, *dbus.Error) {
+	reply := b.call(Request{Command: CommandStatus})
+	return reply.Message, reply.err()
+}
+
+func (b *Bus) ListDevices() ([]string, *dbus.Error) {
+	reply := b.call(Request{Command: CommandDevices})
+	if reply.Message == "" {
+		return []string{}, reply.err()
+	}
+	return strings.Split(reply.Message, "\n"), reply.err()
+}
+
+func (b *Bus) call(request Request) Reply {
+	return Execute(b.requests, request)
+}
+
+func (r Reply) err() *dbus.Error {
+	if r.Err == nil {
+		return nil
+	}
+	return dbus.NewError(busError, []interface{}{r.Err.Error()})
+}
@@ -0,0 +1,234 @@
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/coltwillcox/ngn/protocol"
+)
+
+type Command string
+
+const (
+	CommandPause   Command = "pause"
+	CommandResume  Command = "resume"
+	CommandClear   Command = "clear"
+	CommandStatus  Command = "status"
+	CommandDevices Command = "devices"
+	CommandHistory Command = "history"
+	CommandSend    Command = "send"
+	CommandExit    Command = "exit"
+	socketName             = "ngn.sock"
+	replyOK                = "ok"
+	ReplySent              = "sent"      // Of CommandSend, notification was written to the badge.
+	ReplyCoalesced         = "coalesced" // Of CommandSend, notification will be sent in summary of a burst.
+	replyError             = "error: "
+	timeReply              = 10 // Seconds.
+)
+
+var (
+	ErrUnknownCommand = errors.New("unknown command")
+	ErrNotRunning     = errors.New("daemon not running")
+	ErrTimeout        = errors.New("daemon did not reply in time")
+	ErrNotConnected   = errors.New("badge not connected")
+	ErrPaused         = errors.New("transmitting paused")
+	ErrDropped        = errors.New("notification dropped by throttle")
+)
+
+// Request is a command waiting to be executed by the daemon.
+// Reply is nil if nobody waits for the result (e.g. tray menu click).
+type Request struct {
+	Command      Command
+	Notification *protocol.Notification // Only for CommandSend.
+	Reply        chan Reply
+}
+
+type Reply struct {
+	Message string
+	Err     error
+}
+
+// Server accepts commands on a local Unix socket, one command per connection.
+// Command is a single line, optionally followed by JSON payload after a space (e.g. "send {...}").
+// Reply is written back and connection is closed.
+type Server struct {
+	listener net.Listener
+	requests chan<- Request
+}
+
+// SocketPath returns socket location inside RuntimeDir.
+func SocketPath() (string, error) {
+	dir, err := RuntimeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, socketName), nil
+}
+
+func ParseCommand(command string) (Command, error) {
+	switch c := Command(strings.ToLower(strings.TrimSpace(command))); c {
+	case CommandPause, CommandResume, CommandClear, CommandStatus, CommandDevices, CommandHistory, CommandSend, CommandExit:
+		return c, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownCommand, command)
+	}
+}
+
+// Listen starts accepting commands, received commands are passed to requests channel.
+func Listen(path string, requests chan<- Request) (*Server, error) {
+	if err := RemoveStale(path); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on socket: %w", err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+
+	server := &Server{
+		listener: listener,
+		requests: requests,
+	}
+	go server.accept()
+
+	return server, nil
+}
+
+// RemoveStale removes socket left behind by daemon which did not exit cleanly,
+// but never steals socket from running one.
+func RemoveStale(path string) error {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("daemon already listening on %s", path)
+	}
+	os.Remove(path)
+	return nil
+}
+
+// ListenLoopback listens on TCP "host:port", refusing addresses reachable from other machines.
+func ListenLoopback(address string) (net.Listener, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address: %w", err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("refusing to listen on non loopback address %s", address)
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+	return listener, nil
+}
+
+func (s *Server) Close() error {
+	return s.listener.Close()
+}
+
+func (s *Server) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeReply * time.Second))
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+
+	name, payload, _ := strings.Cut(strings.TrimSpace(line), " ")
+	command, err := ParseCommand(name)
+	if err != nil {
+		fmt.Fprintln(conn, replyError+err.Error())
+		return
+	}
+
+	request := Request{Command: command}
+	if command == CommandSend {
+		request.Notification = &protocol.Notification{}
+		if err := json.Unmarshal([]byte(payload), request.Notification); err != nil {
+			fmt.Fprintln(conn, replyError+"invalid notification: "+err.Error())
+			return
+		}
+	}
+
+	reply := Execute(s.requests, request)
+	if reply.Err != nil {
+		fmt.Fprintln(conn, replyError+reply.Err.Error())
+		return
+	}
+	if reply.Message == "" {
+		reply.Message = replyOK
+	}
+	fmt.Fprintln(conn, reply.Message)
+}
+
+// Execute passes request to the daemon and waits for its reply.
+func Execute(requests chan<- Request, request Request) Reply {
+	request.Reply = make(chan Reply, 1)
+	select {
+	case requests <- request:
+	case <-time.After(timeReply * time.Second):
+		return Reply{Err: ErrTimeout}
+	}
+
+	select {
+	case reply := <-request.Reply:
+		return reply
+	case <-time.After(timeReply * time.Second):
+		return Reply{Err: ErrTimeout}
+	}
+}
+
+// Send passes request to running daemon and returns its reply.
+// Returns ErrNotRunning if there is no daemon listening on path.
+func Send(path string, request Request) (string, error) {
+	conn, err := net.DialTimeout("unix", path, timeReply*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNotRunning, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeReply * time.Second))
+
+	line := string(request.Command)
+	if request.Notification != nil {
+		payload, err := json.Marshal(request.Notification)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal notification: %w", err)
+		}
+		line += " " + string(payload)
+	}
+	if _, err := fmt.Fprintln(conn, line); err != nil {
+		return "", fmt.Errorf("failed to send command: %w", err)
+	}
+
+	data, err := io.ReadAll(conn)
+	if err != nil {
+		return "", fmt.Errorf("failed to read reply: %w", err)
+	}
+	reply := strings.TrimSuffix(string(data), "\n")
+	if strings.HasPrefix(reply, replyError) {
+		return "", errors.New(strings.TrimPrefix(reply, replyError))
+	}
+
+	return reply, nil
+}
@@ -0,0 +1,44 @@
+package control
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+var (
+	ErrNotPrivate = errors.New("not private to current user")
+)
+
+// RuntimeDir returns directory for sockets and secrets: $XDG_RUNTIME_DIR, or private directory of current user
+// inside temporary directory if it is not set. Temporary directory itself is shared, so another user could
+// create files there first.
+func RuntimeDir() (string, error) {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir, nil
+	}
+
+	dir := filepath.Join(os.TempDir(), "ngn-"+strconv.Itoa(os.Getuid()))
+	if err := os.Mkdir(dir, 0700); err != nil && !errors.Is(err, fs.ErrExist) {
+		return "", fmt.Errorf("failed to create runtime directory: %w", err)
+	}
+	if err := CheckPrivate(dir, fs.ModeDir|0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// CheckPrivate verifies that path is not a symlink, has exactly mode and is owned by current user.
+func CheckPrivate(path string, mode fs.FileMode) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&(fs.ModeType|fs.ModePerm) != mode || !owned(info) {
+		return fmt.Errorf("%s %w", path, ErrNotPrivate)
+	}
+	return nil
+}
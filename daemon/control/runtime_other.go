@@ -0,0 +1,10 @@
+//go:build !unix
+
+package control
+
+import "io/fs"
+
+// owned can't tell owner of file, only mode is checked.
+func owned(info fs.FileInfo) bool {
+	return true
+}
@@ -0,0 +1,68 @@
+package hotplug
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Action string
+
+const (
+	ActionAdd    Action = "add"
+	ActionRemove Action = "remove"
+)
+
+var (
+	ErrUnsupported = errors.New("hotplug monitoring not supported on this platform")
+)
+
+// Event is a tty device appearing or disappearing.
+// VendorID and ProductID are known for added USB devices only.
+type Event struct {
+	Action    Action
+	Name      string // Device name, e.g. "ttyACM0".
+	VendorID  string // Lowercase hex, e.g. "2e8a".
+	ProductID string
+}
+
+// Matches reports whether event is about device with given vendor and product ID (e.g. "2e8a:0003").
+// Removed devices can't be identified by ID, so they match if their name is the same as portName.
+func (e Event) Matches(usbID, portName string) bool {
+	if e.Action == ActionRemove || e.VendorID == "" {
+		return e.Name == portName
+	}
+	vendorID, productID, _ := strings.Cut(strings.ToLower(usbID), ":")
+	return e.VendorID == vendorID && (productID == "" || e.ProductID == productID)
+}
+
+// ParseUSBID validates "vendor:product" pair of hex IDs, product may be omitted.
+func ParseUSBID(usbID string) error {
+	vendorID, productID, hasProduct := strings.Cut(usbID, ":")
+	if !isHexID(vendorID) || (hasProduct && !isHexID(productID)) {
+		return fmt.Errorf("invalid USB ID %q, expected vendor:product in hex (e.g. 2e8a:0003)", usbID)
+	}
+	return nil
+}
+
+func isHexID(id string) bool {
+	if len(id) != 4 {
+		return false
+	}
+	_, err := strconv.ParseUint(id, 16, 16)
+	return err == nil
+}
+
+// Backoff returns delay before attempt (starting from 0), doubling from minimum up to maximum.
+func Backoff(attempt int, minimum, maximum time.Duration) time.Duration {
+	delay := minimum
+	for i := 0; i < attempt && delay < maximum; i++ {
+		delay *= 2
+	}
+	if delay > maximum {
+		delay = maximum
+	}
+	return delay
+}
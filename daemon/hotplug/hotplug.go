@@ -0,0 +1,136 @@
+//go:build linux
+
+package hotplug
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	sysClassTTY = "/sys/class/tty"
+	groupKernel = 1    // Netlink multicast group of kernel uevents.
+	bufferSize  = 8192 // Single uevent is limited to a few KiB by the kernel.
+	timePoll    = 1000 // Milliseconds. How often Run checks for cancelled context.
+	maximumUp   = 3    // Levels above tty device searched for USB device attributes.
+)
+
+// Monitor receives kernel uevents about tty devices over netlink socket.
+type Monitor struct {
+	fd int
+}
+
+// NewMonitor opens netlink socket subscribed to kernel uevents.
+func NewMonitor() (*Monitor, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open netlink socket: %w", err)
+	}
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: groupKernel}); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to bind netlink socket: %w", err)
+	}
+
+	return &Monitor{fd: fd}, nil
+}
+
+// Run passes tty events to events channel until ctx is cancelled, then closes the socket.
+func (m *Monitor) Run(ctx context.Context, events chan<- Event) error {
+	defer unix.Close(m.fd)
+
+	buffer := make([]byte, bufferSize)
+	pollFds := []unix.PollFd{{Fd: int32(m.fd), Events: unix.POLLIN}}
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		n, err := unix.Poll(pollFds, timePoll)
+		if err == unix.EINTR || n == 0 {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to poll netlink socket: %w", err)
+		}
+
+		n, _, err = unix.Recvfrom(m.fd, buffer, 0)
+		if err != nil {
+			if err == unix.EINTR || err == unix.EAGAIN || err == unix.ENOBUFS {
+				continue
+			}
+			return fmt.Errorf("failed to read uevent: %w", err)
+		}
+
+		event, ok := parse(buffer[:n])
+		if !ok {
+			continue
+		}
+		select {
+		case events <- event:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// parse decodes kernel uevent ("action@devpath" header followed by NUL separated KEY=value pairs).
+// Only add and remove events of tty subsystem are accepted.
+func parse(data []byte) (Event, bool) {
+	fields := bytes.Split(data, []byte{0})
+	if len(fields) < 2 || !bytes.Contains(fields[0], []byte("@")) {
+		// Messages without header come from udev daemon, not kernel.
+		return Event{}, false
+	}
+
+	event := Event{}
+	subsystem := ""
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(string(field), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "ACTION":
+			event.Action = Action(value)
+		case "DEVNAME":
+			event.Name = filepath.Base(value)
+		case "SUBSYSTEM":
+			subsystem = value
+		}
+	}
+	if subsystem != "tty" || event.Name == "" || (event.Action != ActionAdd && event.Action != ActionRemove) {
+		return Event{}, false
+	}
+
+	if event.Action == ActionAdd {
+		// USB attributes are gone once device is removed, so they are read for added devices only.
+		event.VendorID, event.ProductID = usbID(event.Name)
+	}
+
+	return event, true
+}
+
+// usbID looks up vendor and product ID of USB device that tty device belongs to.
+func usbID(name string) (string, string) {
+	dir, err := filepath.EvalSymlinks(filepath.Join(sysClassTTY, name, "device"))
+	if err != nil {
+		return "", ""
+	}
+
+	for i := 0; i < maximumUp; i++ {
+		vendorID, err := os.ReadFile(filepath.Join(dir, "idVendor"))
+		if err == nil {
+			productID, _ := os.ReadFile(filepath.Join(dir, "idProduct"))
+			return strings.TrimSpace(string(vendorID)), strings.TrimSpace(string(productID))
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	return "", ""
+}
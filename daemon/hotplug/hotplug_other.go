@@ -0,0 +1,16 @@
+//go:build !linux
+
+package hotplug
+
+import "context"
+
+// Monitor is not available outside of Linux, callers fall back to polling.
+type Monitor struct{}
+
+func NewMonitor() (*Monitor, error) {
+	return nil, ErrUnsupported
+}
+
+func (m *Monitor) Run(ctx context.Context, events chan<- Event) error {
+	return ErrUnsupported
+}
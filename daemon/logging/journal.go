@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	journalSocket     = "/run/systemd/journal/socket"
+	journalIdentifier = "ngn"
+)
+
+// journal writes entries to systemd journal using its native protocol, with structured fields kept as journal fields.
+type journal struct {
+	conn *net.UnixConn
+}
+
+func newJournal() (*journal, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to journal: %w", err)
+	}
+	return &journal{conn: conn}, nil
+}
+
+func (j *journal) Write(p []byte) (int, error) {
+	return j.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel receives JSON encoded entry from zerolog and converts it to journal fields.
+func (j *journal) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	entry := map[string]any{}
+	if err := json.Unmarshal(p, &entry); err != nil {
+		return 0, fmt.Errorf("failed to decode log entry: %w", err)
+	}
+
+	buffer := &bytes.Buffer{}
+	writeJournalField(buffer, "MESSAGE", fmt.Sprint(entry[zerolog.MessageFieldName]))
+	writeJournalField(buffer, "PRIORITY", fmt.Sprint(toJournalPriority(level)))
+	writeJournalField(buffer, "SYSLOG_IDENTIFIER", journalIdentifier)
+	for key, value := range entry {
+		if key == zerolog.MessageFieldName || key == zerolog.LevelFieldName || key == zerolog.TimestampFieldName {
+			continue
+		}
+		writeJournalField(buffer, strings.ToUpper(key), fmt.Sprint(value))
+	}
+
+	if _, err := j.conn.Write(buffer.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (j *journal) Close() error {
+	return j.conn.Close()
+}
+
+// writeJournalField uses binary safe form of a field, since values may contain new lines.
+func writeJournalField(buffer *bytes.Buffer, key, value string) {
+	buffer.WriteString(key)
+	buffer.WriteByte('\n')
+	binary.Write(buffer, binary.LittleEndian, uint64(len(value)))
+	buffer.WriteString(value)
+	buffer.WriteByte('\n')
+}
+
+func toJournalPriority(level zerolog.Level) int {
+	switch level {
+	case zerolog.ErrorLevel:
+		return 3
+	case zerolog.WarnLevel:
+		return 4
+	case zerolog.InfoLevel:
+		return 6
+	default:
+		return 7
+	}
+}
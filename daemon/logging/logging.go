@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	logz "git.sr.ht/~blallo/logz/interface"
+	"github.com/rs/zerolog"
+)
+
+const (
+	FormatConsole  = "console"
+	FormatJSON     = "json"
+	fileName       = "ngn.log"
+	fileMaximum    = 5 << 20 // Bytes, file is rotated when it gets larger.
+	fileBackups    = 3
+	fieldError     = "err"
+	directoryState = ".local/state"
+)
+
+// Fields are structured fields attached to a log entry, e.g. serial, program, port, bytes.
+type Fields map[string]any
+
+type Config struct {
+	Level   logz.LogLevel
+	Format  string // FormatConsole or FormatJSON.
+	File    bool   // Also write (JSON) logs to a rotated file, see FilePath.
+	Journal bool   // Also write logs to systemd journal.
+}
+
+type Logger struct {
+	log     zerolog.Logger
+	closers []io.Closer
+}
+
+// FilePath returns log file location inside $XDG_STATE_HOME.
+func FilePath() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, directoryState)
+	}
+	return filepath.Join(dir, "ngn", fileName)
+}
+
+func New(config Config) (*Logger, error) {
+	logger := &Logger{}
+
+	var console io.Writer = os.Stdout
+	if config.Format == FormatConsole {
+		console = zerolog.ConsoleWriter{Out: os.Stdout}
+	} else if config.Format != FormatJSON {
+		return nil, fmt.Errorf("unknown log format %q", config.Format)
+	}
+	writers := []io.Writer{console}
+
+	if config.File {
+		file, err := newRotatingFile(FilePath(), fileMaximum, fileBackups)
+		if err != nil {
+			return nil, err
+		}
+		writers = append(writers, file)
+		logger.closers = append(logger.closers, file)
+	}
+
+	if config.Journal {
+		journal, err := newJournal()
+		if err != nil {
+			logger.Close()
+			return nil, err
+		}
+		writers = append(writers, journal)
+		logger.closers = append(logger.closers, journal)
+	}
+
+	logger.log = zerolog.New(zerolog.MultiLevelWriter(writers...)).Level(toZerologLevel(config.Level)).With().Timestamp().Logger()
+
+	return logger, nil
+}
+
+// Log writes message, with first non nil error if any.
+func (l *Logger) Log(level logz.LogLevel, msg string, errs ...error) {
+	l.LogFields(level, msg, nil, errs...)
+}
+
+// LogFields writes message with structured fields, and first non nil error if any.
+func (l *Logger) LogFields(level logz.LogLevel, msg string, fields Fields, errs ...error) {
+	event := l.log.WithLevel(toZerologLevel(level))
+	if event == nil {
+		return
+	}
+	if len(fields) > 0 {
+		event = event.Fields(map[string]any(fields))
+	}
+	if len(errs) > 0 && errs[0] != nil {
+		event = event.Str(fieldError, errs[0].Error())
+	}
+	event.Msg(msg)
+}
+
+func (l *Logger) Close() error {
+	var result error
+	for _, closer := range l.closers {
+		if err := closer.Close(); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
+
+func toZerologLevel(level logz.LogLevel) zerolog.Level {
+	switch level {
+	case logz.LogTrace:
+		return zerolog.TraceLevel
+	case logz.LogDebug:
+		return zerolog.DebugLevel
+	case logz.LogInfo:
+		return zerolog.InfoLevel
+	case logz.LogWarn:
+		return zerolog.WarnLevel
+	case logz.LogErr:
+		return zerolog.ErrorLevel
+	default:
+		return zerolog.Disabled
+	}
+}
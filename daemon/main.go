@@ -2,65 +2,239 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"fyne.io/systray"
 	"git.sr.ht/~blallo/conductor"
 	logz "git.sr.ht/~blallo/logz/interface"
-	"git.sr.ht/~blallo/logz/zlog"
 	"git.sr.ht/~blallo/notilog"
 	"github.com/godbus/dbus/v5"
 	"go.bug.st/serial"
 
+	"github.com/coltwillcox/ngn/daemon/api"
 	"github.com/coltwillcox/ngn/daemon/assets"
+	"github.com/coltwillcox/ngn/daemon/control"
+	"github.com/coltwillcox/ngn/daemon/hotplug"
+	"github.com/coltwillcox/ngn/daemon/logging"
+	"github.com/coltwillcox/ngn/daemon/markup"
 	"github.com/coltwillcox/ngn/daemon/media"
+	"github.com/coltwillcox/ngn/daemon/metrics"
+	"github.com/coltwillcox/ngn/daemon/server"
+	"github.com/coltwillcox/ngn/daemon/throttle"
+	"github.com/coltwillcox/ngn/daemon/translit"
 	"github.com/coltwillcox/ngn/daemon/utils"
+	"github.com/coltwillcox/ngn/daemon/widgets"
+	"github.com/coltwillcox/ngn/protocol"
 )
 
-type Notification struct {
-	Program   string `json:"program,omitempty"`
-	Title     string `json:"title,omitempty"`
-	Body      string `json:"body,omitempty"`
-	Sender    string `json:"sender,omitempty"`
-	Serial    string `json:"serial,omitempty"`
-	CreatedAt string `json:"created_at,omitempty"`
-	Icon      string `json:"icon,omitempty"`
-}
-
 const (
-	badgePort              = "/dev/ttyACM0"
-	commandClear           = "clear"
-	messageLength          = 128
-	timeConnectCheck       = 5   // Seconds.
-	timeRest               = 10  // Milliseconds.
-	timePartialSender      = 50  // Milliseconds.
-	timeSender             = 100 // Milliseconds.
-	separator         rune = '*'
+	badgeUSBID         = "2e8a:0003" // Vendor and product ID of Gopher Badge running TinyGo.
+	messageLength      = 128
+	timeConnectCheck   = 5    // Seconds. Port polling interval, when hotplug events are not available.
+	timeBackoffMinimum = 1    // Seconds.
+	timeBackoffMaximum = 30   // Seconds.
+	timeRest           = 10   // Milliseconds.
+	timePartialSender  = 50   // Milliseconds.
+	timeSender         = 100  // Milliseconds.
+	timeHandshake      = 1000 // Milliseconds. Waiting for badge capabilities.
+	timeShutdown       = 5    // Seconds. Maximum time spent stopping listener and flushing pending notifications.
+	timeCoalesce       = 3    // Seconds.
+	timeDedup          = 10   // Seconds.
+	rateProgram        = 0.2  // Notifications per second, per program.
+	burstProgram       = 3    // Notifications sent immediately before program gets rate limited.
+	historySize        = 10
+	bitmapWidth        = 296 // Pixels. Inside of badge message view.
+	bitmapTitleLines   = 5
+	bitmapBodyLines    = 6
+	bitmapBudget       = 6 * 1024 // Bytes of title and body bitmaps together, about 3 seconds of serial transfer.
+	timeClockSync      = 15       // Minutes. Badge clock drifts between syncs.
 )
 
 // Icons taken from https://github.com/egonelbre/gophers
 var (
-	paused = false
+	badgePort      = "/dev/ttyACM0" // Follows the badge, if it is plugged in under another name.
+	usbID          = badgeUSBID
+	capabilities   = protocol.Capabilities{Charset: protocol.CharsetASCII} // Of connected badge.
+	badgeArt       = map[string]string{}                                   // Widget.ArtID of art connected badge has, by widget kind.
+	paused         = false
+	serverMode     = false
+	headless       = false
+	apiAddress     = ""
+	metricsAddress = ""
+	renderText     = false
+	renderFonts    = ""
+	groupByProgram = "" // Badge setting sent on connect, empty keeps the one stored on badge.
+	historyDepth   = 0  // Badge setting sent on connect, 0 keeps the one stored on badge.
+	widgetKinds    = ""
+	logLevel       = logz.LogInfo.String()
+	logFormat      = logging.FormatConsole
+	logFile        = false
+	logJournal     = false
+	sent           = make([]historyEntry, 0, historySize) // Recently sent notifications.
 
 	channelConnection chan bool
 	channelMessage    chan *dbus.Message
+	channelControl    chan control.Request
+	channelDone       chan struct{} // Closed when main loop has finished.
+	channelHotplug    chan hotplug.Event
+	channelWake       chan struct{} // Badge plugged in, skip waiting for reconnect.
+	channelRead       chan string   // IDs of notifications read on the badge.
+	channelAction     chan string   // Arguments of CommandAction, for buttons pressed on badge widgets.
+	hotplugStopped    chan struct{} // Closed when hotplug monitor has failed.
+	hotplugRunning    atomic.Bool
+	reconnectAttempts atomic.Int32
+	ctx               context.Context
+	cancel            context.CancelFunc
+	throttler         *throttle.Throttle
+	widgetSet         *widgets.Widgets
+	notifyServer      *server.Server
+	controlServer     *control.Server
+	controlBus        *control.Bus
+	apiServer         *api.Server
+	metricsServer     *metrics.Server
+	connected         atomic.Bool
+	mPause            *systray.MenuItem
+	textRenderer      *media.TextRenderer // Nil if daemon does not render text.
+	logger            *logging.Logger
 	log               func(logz.LogLevel, string, ...error)
+	logWith           func(logz.LogLevel, string, logging.Fields, ...error)
 )
 
+// historyEntry is a notification in badge history, with read state reported by the badge.
+type historyEntry struct {
+	protocol.Notification
+	Read bool
+}
+
 func main() {
-	initialize()
+	command, args := commandDaemon, os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case commandDaemon:
+		runDaemon(args)
+	case commandSend:
+		os.Exit(runSend(args))
+	case commandCtl:
+		os.Exit(runCtl(args))
+	case commandHelp:
+		usage(os.Stdout)
+	default:
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+}
+
+func runDaemon(args []string) {
+	initialize(args)
+
+	// Daemon lifecycle, cancelled on SIGINT/SIGTERM or exit command (tray Exit, "ngn ctl exit").
+	ctx, cancel = signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if headless {
+		run(ctx)
+		onExit()
+		return
+	}
+
 	systray.Run(onReady, onExit)
 }
 
-func initialize() {
+func initialize(args []string) {
+	flags := flag.NewFlagSet(commandDaemon, flag.ExitOnError)
+	flags.BoolVar(&serverMode, "server", serverMode, "act as notification daemon if no other daemon is running")
+	flags.BoolVar(&headless, "headless", headless, "run without system tray, control through \"ngn ctl\"")
+	flags.StringVar(&apiAddress, "api", apiAddress, "serve notifications API on loopback \"host:port\" or \"unix:/path/to/socket\"")
+	flags.StringVar(&usbID, "usb-id", usbID, "badge USB \"vendor:product\" ID in hex, used to detect when it is plugged in")
+	flags.StringVar(&metricsAddress, "metrics", metricsAddress, "serve Prometheus metrics on loopback \"host:port\"")
+	flags.BoolVar(&renderText, "render-text", renderText, "render title and body as bitmaps, for full Unicode and emoji on the badge")
+	flags.StringVar(&renderFonts, "render-fonts", renderFonts, "comma separated TrueType fonts used with -render-text, in order of preference")
+	flags.StringVar(&groupByProgram, "group", groupByProgram, "group badge history by application, \"on\" or \"off\" (badge remembers it)")
+	flags.IntVar(&historyDepth, "history-depth", historyDepth, "number of notifications kept by the badge, up to what badge supports (badge remembers it)")
+	flags.StringVar(&widgetKinds, "widgets", widgetKinds, "comma separated widgets fed to the badge, \"playing\", \"stats\" and \"pomodoro\", none by default")
+	flags.StringVar(&logLevel, "log-level", logLevel, "trace, debug, info, warning or error")
+	flags.StringVar(&logFormat, "log-format", logFormat, "console or json")
+	flags.BoolVar(&logFile, "log-file", logFile, "also write logs to "+logging.FilePath())
+	flags.BoolVar(&logJournal, "log-journal", logJournal, "also write logs to systemd journal")
+	flags.Parse(args)
+
+	if err := hotplug.ParseUSBID(usbID); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if groupByProgram != "" && groupByProgram != protocol.ArgumentOn && groupByProgram != protocol.ArgumentOff {
+		fmt.Fprintf(os.Stderr, "invalid group %q\n", groupByProgram)
+		os.Exit(2)
+	}
+	if historyDepth < 0 {
+		fmt.Fprintf(os.Stderr, "invalid history depth %d\n", historyDepth)
+		os.Exit(2)
+	}
+	providers, err := widgets.Parse(widgetKinds)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	level, err := logz.ToLevel(logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if logger, err = logging.New(logging.Config{Level: level, Format: logFormat, File: logFile, Journal: logJournal}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	log = logger.Log
+	logWith = logger.LogFields
+
+	if renderText {
+		fontPaths := make([]string, 0)
+		for _, fontPath := range strings.Split(renderFonts, ",") {
+			if fontPath = strings.TrimSpace(fontPath); fontPath != "" {
+				fontPaths = append(fontPaths, fontPath)
+			}
+		}
+		if textRenderer, err = media.NewTextRenderer(fontPaths...); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
 	channelMessage = make(chan *dbus.Message, 100)
 	channelConnection = make(chan bool, 1)
-	log = logFn()
+	channelControl = make(chan control.Request, 1)
+	channelDone = make(chan struct{})
+	channelWake = make(chan struct{}, 1)
+	channelRead = make(chan string, 10)
+	channelAction = make(chan string, 10)
+	hotplugStopped = make(chan struct{})
+	throttler = throttle.New(throttle.Config{
+		Rate:   rateProgram,
+		Burst:  burstProgram,
+		Window: timeCoalesce * time.Second,
+		Dedup:  timeDedup * time.Second,
+	}, cap(channelMessage))
+	widgetSet = widgets.New(10, providers...)
+	metrics.NewGaugeFunc("ngn_queue_depth", "Notifications waiting to be sent to the badge.", func() float64 {
+		return float64(len(throttler.Out()))
+	})
 }
 
 func onReady() {
@@ -70,168 +244,840 @@ func onReady() {
 	time.Sleep(timeRest * time.Millisecond) // Give some time to set icon.
 
 	mClear := addClearItem()
-	mPause := addPauseItem()
+	mPause = addPauseItem()
 	mExit := addExitItem()
 
 	go func() {
-		var err error
-		if listener, err := notilog.NewNotiListener(channelMessage); err != nil {
-			log(logz.LogErr, "failed to initialize listener", err)
-			systray.Quit()
-		} else {
-			go func() {
-				if err := listener.Run(conductor.Simple[notilog.Action]()); err != nil {
-					log(logz.LogErr, "execution failed", err)
-				}
-				log(logz.LogInfo, "exited successfully")
-			}()
-		}
-
-		var port serial.Port
-		channelConnection <- true
 		for {
 			select {
 			case <-mExit.ClickedCh:
-				systray.Quit()
+				channelControl <- control.Request{Command: control.CommandExit}
 			case <-mClear.ClickedCh:
-				if _, err = port.Write([]byte(commandClear + string(separator))); err != nil {
-					prepareForReconnect(log, &port, "failed to write to port", err)
-					channelConnection <- true
-					continue
-				}
-				// Give some time to Gopher Badge to process message.
-				time.Sleep(timeSender * time.Millisecond)
+				channelControl <- control.Request{Command: control.CommandClear}
 			case <-mPause.ClickedCh:
-				paused = !paused
-				if paused {
-					mPause.Check()
+				if mPause.Checked() {
+					channelControl <- control.Request{Command: control.CommandResume}
 				} else {
-					mPause.Uncheck()
-				}
-			case dbusMessage := <-channelMessage:
-				if paused || port == nil || dbusMessage == nil {
-					continue
+					channelControl <- control.Request{Command: control.CommandPause}
 				}
+			}
+		}
+	}()
 
-				notiNotification, err := notilog.FromMessage(dbusMessage)
-				if err != nil {
-					if errors.Is(err, notilog.ErrNotANotification) {
-						log(logz.LogDebug, "message not a notification")
-					} else {
-						log(logz.LogWarn, "failed translating to message", err)
-					}
-					continue
-				}
+	go func() {
+		run(ctx)
+		systray.Quit()
+	}()
+}
 
-				log(logz.LogInfo, fmt.Sprintf("message intercepted: %v\n", notiNotification))
+// run is the main loop, it returns after ctx is cancelled and everything is shut down.
+func run(ctx context.Context) {
+	defer close(channelDone)
 
-				// Converting notilog.Notification to our Notification because we have to send all types as strings.
-				// It's easier to unmarshal strings on badge side.
-				iconFilePath := utils.ExtractFilePath(dbusMessage.Body)
-				iconFallback := "A"
-				if len(notiNotification.Title) > 1 {
-					iconFallback = strings.ToUpper(notiNotification.Program[:1])
-				}
-				notification := Notification{
-					Program:   notiNotification.Program,
-					Title:     notiNotification.Title,
-					Body:      notiNotification.Body,
-					Sender:    notiNotification.Sender,
-					Serial:    strconv.Itoa(int(notiNotification.Serial)),
-					CreatedAt: time.Now().Format("2006-01-02 15:04:05"),
-					Icon:      media.GenerateImageData(iconFilePath, iconFallback),
+	var err error
+	listenerConductor := conductor.Simple[notilog.Action]()
+	listenerDone := make(chan struct{})
+	if listener, err := notilog.NewNotiListener(channelMessage); err != nil {
+		log(logz.LogErr, "failed to initialize listener", err)
+		close(listenerDone)
+		quit()
+	} else {
+		go func() {
+			defer close(listenerDone)
+			if err := listener.Run(listenerConductor); err != nil {
+				log(logz.LogErr, "execution failed", err)
+			}
+			log(logz.LogInfo, "exited successfully")
+		}()
+	}
+
+	if monitor, err := hotplug.NewMonitor(); err != nil {
+		log(logz.LogWarn, "hotplug events not available, polling for badge", err)
+	} else {
+		channelHotplug = make(chan hotplug.Event, 10)
+		hotplugRunning.Store(true)
+		go func() {
+			if err := monitor.Run(ctx, channelHotplug); err != nil {
+				log(logz.LogWarn, "hotplug monitor failed, polling for badge", err)
+			}
+			hotplugRunning.Store(false)
+			close(hotplugStopped)
+		}()
+	}
+
+	if serverMode {
+		if notifyServer, err = server.New(); err != nil {
+			if errors.Is(err, server.ErrNameTaken) {
+				log(logz.LogInfo, "notification daemon already running, server not started")
+			} else {
+				log(logz.LogErr, "failed to start notification server", err)
+			}
+		} else {
+			log(logz.LogInfo, "notification server started")
+		}
+	}
+
+	if socketPath, err := control.SocketPath(); err != nil {
+		log(logz.LogWarn, "failed to start control socket", err)
+	} else if controlServer, err = control.Listen(socketPath, channelControl); err != nil {
+		log(logz.LogWarn, "failed to start control socket", err)
+	}
+	if controlBus, err = control.ExportBus(channelControl); err != nil {
+		log(logz.LogWarn, "failed to export control interface", err)
+	}
+	if apiAddress != "" {
+		if tokenPath, err := api.TokenPath(); err != nil {
+			log(logz.LogErr, "failed to load API token", err)
+		} else if token, err := api.LoadToken(tokenPath); err != nil {
+			log(logz.LogErr, "failed to load API token", err)
+		} else if apiServer, err = api.Listen(apiAddress, token, channelControl); err != nil {
+			log(logz.LogErr, "failed to start API", err)
+		} else {
+			log(logz.LogInfo, "API listening on "+apiAddress)
+		}
+	}
+	if metricsAddress != "" {
+		if metricsServer, err = metrics.Listen(metricsAddress); err != nil {
+			log(logz.LogErr, "failed to start metrics", err)
+		} else {
+			log(logz.LogInfo, "metrics listening on "+metricsAddress)
+		}
+	}
+
+	var port serial.Port
+	var portLost chan error // Reports of watchPort for current connection, nil while disconnected.
+	stopWatch := context.CancelFunc(func() {})
+	// disconnect closes port and starts reconnecting. Port is closed only here, on main loop.
+	disconnect := func(message string, err error) {
+		stopWatch()
+		portLost = nil
+		prepareForReconnect(log, &port, message, err)
+		go waitForReconnect(ctx)
+	}
+	// Requests waiting for their notification to be written to the badge, by notification ID.
+	pending := make(map[string]chan control.Reply)
+	settle := func(id string, err error) {
+		if replies, ok := pending[id]; ok {
+			delete(pending, id)
+			reply := control.Reply{Message: control.ReplySent, Err: err}
+			if err != nil {
+				reply.Message = ""
+			}
+			replies <- reply
+		}
+	}
+	messages := channelMessage
+	widgetSet.Start(ctx, func(kind string, err error) {
+		logWith(logz.LogWarn, "widget stopped", logging.Fields{"widget": kind}, err)
+	})
+	clockSync := time.NewTicker(timeClockSync * time.Minute)
+	defer clockSync.Stop()
+	channelConnection <- true
+	for {
+		select {
+		case <-ctx.Done():
+			log(logz.LogInfo, "shutting down...")
+			conductor.Send(listenerConductor)(notilog.StopAction)
+			select {
+			case <-listenerDone:
+			case <-time.After(timeShutdown * time.Second):
+				log(logz.LogWarn, "listener did not stop in time")
+			}
+			stopWatch()
+			shutdown(port)
+			return
+		case request := <-channelControl:
+			reply := control.Reply{}
+			switch request.Command {
+			case control.CommandExit:
+				quit()
+			case control.CommandPause, control.CommandResume:
+				paused = request.Command == control.CommandPause
+				setPaused(paused)
+			case control.CommandStatus:
+				reply.Message = status(port)
+			case control.CommandHistory:
+				lines := make([]string, 0, len(sent))
+				for _, sentNotification := range sent {
+					line := fmt.Sprintf("%s %s: %s", sentNotification.CreatedAt, sentNotification.Program, sentNotification.Title)
+					if !sentNotification.Read {
+						line += " (unread)"
+					}
+					lines = append(lines, line)
 				}
-				serialMessage, err := json.Marshal(notification)
+				reply.Message = strings.Join(lines, "\n")
+			case control.CommandDevices:
+				portsNames, err := serial.GetPortsList()
 				if err != nil {
-					log(logz.LogErr, "failed to marshal notification", err)
-					continue
+					reply.Err = err
+					break
+				}
+				reply.Message = strings.Join(portsNames, "\n")
+			case control.CommandSend:
+				if request.Notification == nil {
+					break
+				}
+				if paused {
+					reply.Err = control.ErrPaused
+					break
+				}
+				if port == nil {
+					reply.Err = control.ErrNotConnected
+					break
+				}
+				badgeNotification := *request.Notification
+				if badgeNotification.CreatedAt == "" {
+					badgeNotification.CreatedAt = time.Now().Format(protocol.TimeFormat)
+				}
+				badgeNotification.ID = notificationID()
+				result := throttler.Add(badgeNotification)
+				if result == throttle.Dropped {
+					reply.Err = control.ErrDropped
+					break
+				}
+				if result == throttle.Coalesced {
+					reply.Message = control.ReplyCoalesced
+					break
+				}
+				// Reply once notification is written to the badge.
+				if request.Reply != nil {
+					pending[badgeNotification.ID] = request.Reply
+				}
+				continue
+			case control.CommandClear:
+				if port == nil {
+					reply.Err = control.ErrNotConnected
+					break
+				}
+				if _, err = port.Write(protocol.AppendCommand(nil, protocol.CommandClear)); err != nil {
+					reply.Err = err
+					metrics.SerialWriteErrors.Inc()
+					disconnect("failed to write to port", err)
+					break
 				}
+				// Give some time to Gopher Badge to process message.
+				time.Sleep(timeSender * time.Millisecond)
+				for i := range sent {
+					sent[i].Read = true
+				}
+			}
+			if request.Reply != nil {
+				request.Reply <- reply
+			}
+		case dbusMessage, ok := <-messages:
+			if !ok {
+				// Listener closes channel when stopped.
+				messages = nil
+				continue
+			}
+			if dbusMessage == nil {
+				continue
+			}
 
-				serialMessage = append(serialMessage, byte(separator))
-				// Maximum single message length that can be transmitted to Gopher Badge is 128 bytes.
-				// If message is larger than that, end will be truncated, therefore, we are spliting message into chunks of 128 bytes.
-				serialMessageParts := [][]byte{}
-				for i := 0; i < len(serialMessage); i += messageLength {
-					end := i + messageLength
+			notiNotification, err := notilog.FromMessage(dbusMessage)
+			if err != nil {
+				if errors.Is(err, notilog.ErrNotANotification) {
+					log(logz.LogDebug, "message not a notification")
+				} else {
+					log(logz.LogWarn, "failed translating to message", err)
+				}
+				continue
+			}
 
-					if end > len(serialMessage) {
-						end = len(serialMessage)
-					}
+			logWith(logz.LogInfo, "message intercepted", logging.Fields{"program": notiNotification.Program, "serial": notiNotification.Serial, "title": notiNotification.Title})
+			metrics.NotificationsCaptured.Inc()
+			if paused {
+				metrics.NotificationsFiltered.With("paused").Inc()
+				continue
+			}
+			if port == nil {
+				metrics.NotificationsFiltered.With("disconnected").Inc()
+				continue
+			}
 
-					serialMessageParts = append(serialMessageParts, serialMessage[i:end])
+			// Converting notilog.Notification to our Notification because we have to send all types as strings.
+			// It's easier to unmarshal strings on badge side.
+			iconFilePath := utils.ExtractFilePath(dbusMessage.Body)
+			badgeNotification := protocol.Notification{
+				Program:   notiNotification.Program,
+				Title:     notiNotification.Title,
+				Body:      notiNotification.Body,
+				Sender:    notiNotification.Sender,
+				Serial:    strconv.Itoa(int(notiNotification.Serial)),
+				CreatedAt: time.Now().Format(protocol.TimeFormat),
+				IconPath:  iconFilePath,
+				Urgency:   utils.ExtractUrgency(dbusMessage.Body),
+				Sticky:    utils.ExtractSticky(dbusMessage.Body),
+			}
+			renderMarkup(&badgeNotification)
+			if throttler.Add(badgeNotification) == throttle.Dropped {
+				metrics.NotificationsFiltered.With("throttle").Inc()
+				logWith(logz.LogDebug, "message dropped by throttle", logging.Fields{"program": badgeNotification.Program, "serial": badgeNotification.Serial})
+			}
+		case badgeNotification := <-throttler.Out():
+			if paused {
+				metrics.NotificationsFiltered.With("paused").Inc()
+				settle(badgeNotification.ID, control.ErrPaused)
+				continue
+			}
+			if port == nil {
+				metrics.NotificationsFiltered.With("disconnected").Inc()
+				settle(badgeNotification.ID, control.ErrNotConnected)
+				continue
+			}
+
+			// Notifications sent by control requests already have ID, to report the result.
+			if badgeNotification.ID == "" {
+				badgeNotification.ID = notificationID()
+			}
+			fields := logging.Fields{"program": badgeNotification.Program, "serial": badgeNotification.Serial, "id": badgeNotification.ID, "port": badgePort}
+			bytesSent, err := sendNotification(port, badgeNotification)
+			fields["bytes"] = bytesSent
+			metrics.BytesTransmitted.Add(uint64(bytesSent))
+			if err != nil {
+				metrics.NotificationsFailed.Inc()
+				metrics.SerialWriteErrors.Inc()
+				logWith(logz.LogErr, "failed to send notification", fields, err)
+				settle(badgeNotification.ID, fmt.Errorf("failed to send notification: %w", err))
+				updateTooltip()
+				continue
+			}
+			settle(badgeNotification.ID, nil)
+			metrics.NotificationsSent.Inc()
+			logWith(logz.LogInfo, "notification sent", fields)
+			updateTooltip()
+
+			if len(sent) >= max(historySize, historyDepth) {
+				sent = sent[1:]
+			}
+			sent = append(sent, historyEntry{Notification: badgeNotification})
+		case id := <-channelRead:
+			for i := range sent {
+				if sent[i].ID == id && !sent[i].Read {
+					sent[i].Read = true
+					metrics.NotificationsRead.Inc()
+					logWith(logz.LogDebug, "notification read on badge", logging.Fields{"program": sent[i].Program, "serial": sent[i].Serial, "id": id})
+				}
+			}
+		case widget := <-widgetSet.Out():
+			if port == nil {
+				continue
+			}
+			if err := sendWidget(port, widget); err != nil {
+				metrics.SerialWriteErrors.Inc()
+				// Widget is sent again from Latest once reconnected.
+				disconnect("failed to send widget", err)
+			}
+		case argument := <-channelAction:
+			kind, action, ok := protocol.ParseAction(argument)
+			if !ok {
+				continue
+			}
+			if err := widgetSet.Action(kind, action); err != nil {
+				log(logz.LogWarn, "badge pressed button on widget daemon does not feed", err)
+				continue
+			}
+			logWith(logz.LogDebug, "widget action on badge", logging.Fields{"widget": kind, "action": action})
+		case <-clockSync.C:
+			if port != nil {
+				syncClock(port)
+			}
+		case event := <-channelHotplug:
+			if !event.Matches(usbID, filepath.Base(badgePort)) {
+				continue
+			}
+			logWith(logz.LogDebug, "badge hotplug event", logging.Fields{"action": event.Action, "device": event.Name})
+			switch event.Action {
+			case hotplug.ActionAdd:
+				if port == nil {
+					badgePort = filepath.Join("/dev", event.Name)
+					notify(channelWake)
 				}
+			case hotplug.ActionRemove:
+				if port != nil {
+					disconnect("badge unplugged", nil)
+				}
+			}
+		case err := <-portLost:
+			disconnect("lost badge", err)
+		case <-channelConnection:
+			port, err = serial.Open(badgePort, &serial.Mode{})
+			if err != nil {
+				disconnect("failed to open port", err)
+				continue
+			}
 
-				// Send to serial.
-				for _, serialMessagePart := range serialMessageParts {
-					if _, err = port.Write(serialMessagePart); err != nil {
-						log(logz.LogErr, "failed to write to port", err)
-						break
-					}
-					// Give some time to Gopher Badge to process each part. Required for multipart messages.
-					time.Sleep(timePartialSender * time.Millisecond)
+			reconnectAttempts.Store(0)
+			capabilities = handshake(port)
+			badgeArt = map[string]string{}
+			if groupByProgram != "" {
+				if _, err := port.Write(protocol.AppendCommandArgument(nil, protocol.CommandGroup, groupByProgram)); err != nil {
+					log(logz.LogWarn, "failed to set grouping on badge", err)
 				}
-				// Give some time to Gopher Badge to process message.
-				time.Sleep(timeSender * time.Millisecond)
-			case <-channelConnection:
-				port, err = serial.Open(badgePort, &serial.Mode{})
-				if err != nil {
-					go func() {
-						prepareForReconnect(log, &port, "failed to open port", err)
-						channelConnection <- true
-					}()
-					continue
+			}
+			if historyDepth > 0 {
+				setHistoryDepth(port)
+			}
+			syncClock(port)
+			for _, widget := range widgetSet.Latest() {
+				if err := sendWidget(port, widget); err != nil {
+					logWith(logz.LogWarn, "failed to send widget", logging.Fields{"widget": widget.Kind}, err)
 				}
+			}
+			setConnected(true)
+			logWith(logz.LogInfo, "connected", logging.Fields{"port": badgePort, "charset": capabilities.Charset, "bitmap": capabilities.Bitmap, "version": capabilities.Version, "widgets": strings.Join(capabilities.Widgets, ",")})
+			if capabilities.Version != protocol.Version {
+				// Older badges still understand notifications, but may ignore newer fields and commands.
+				logWith(logz.LogWarn, "badge protocol version differs, update firmware", logging.Fields{"badge": capabilities.Version, "daemon": protocol.Version})
+			}
 
-				systray.SetIcon(assets.IconOnline)
-				systray.SetTooltip("Connected")
-				log(logz.LogInfo, "connected")
-
-				// Port existing/connected listener.
-				go func() {
-					for {
-						time.Sleep(timeConnectCheck * time.Second)
-						portsNames, err := serial.GetPortsList()
-						if err != nil {
-							prepareForReconnect(log, &port, "failed to get ports", err)
-							break
-						}
-						if len(portsNames) == 0 {
-							prepareForReconnect(log, &port, "no serial ports found", nil)
-							break
-						}
-						existing := false
-						for _, portName := range portsNames {
-							if portName == badgePort {
-								existing = true
-								continue
-							}
-						}
-						if !existing {
-							prepareForReconnect(log, &port, "port does not exist", nil)
-							break
-						}
-					}
-					channelConnection <- true
-				}()
+			var watchCtx context.Context
+			watchCtx, stopWatch = context.WithCancel(ctx)
+			portLost = make(chan error, 1)
+			go watchPort(watchCtx, badgePort, portLost)
+			go readPort(ctx, port)
+		}
+	}
+}
+
+// setHistoryDepth asks the badge to keep historyDepth notifications, or as many as it can.
+func setHistoryDepth(port serial.Port) {
+	depth := historyDepth
+	if capabilities.History == 0 {
+		log(logz.LogWarn, "badge firmware has fixed history depth, update it")
+		return
+	}
+	if depth > capabilities.History {
+		logWith(logz.LogWarn, "badge can't keep that many notifications", logging.Fields{"requested": depth, "maximum": capabilities.History})
+		depth = capabilities.History
+	}
+	if _, err := port.Write(protocol.AppendCommandArgument(nil, protocol.CommandDepth, strconv.Itoa(depth))); err != nil {
+		log(logz.LogWarn, "failed to set history depth on badge", err)
+	}
+}
+
+// syncClock sends local time to the badge, which keeps it with its own timer until the next sync.
+func syncClock(port serial.Port) {
+	now := time.Now()
+	_, offset := now.Zone()
+	if _, err := port.Write(protocol.AppendTime(nil, now.Unix(), offset)); err != nil {
+		log(logz.LogWarn, "failed to set clock on badge", err)
+	}
+}
+
+// readPort passes IDs of notifications read on the badge, and actions pressed on its widgets, to main loop,
+// until port is closed.
+func readPort(ctx context.Context, port serial.Port) {
+	decoder := protocol.Decoder{}
+	buffer := make([]byte, messageLength)
+	for {
+		n, err := port.Read(buffer)
+		if err != nil {
+			return
+		}
+		for _, singleByte := range buffer[:n] {
+			message, ok, _ := decoder.Feed(singleByte)
+			if !ok || message.Argument == "" {
+				continue
+			}
+			var channel chan string
+			switch message.Command {
+			case protocol.CommandRead:
+				channel = channelRead
+			case protocol.CommandAction:
+				channel = channelAction
+			default:
+				continue
+			}
+			select {
+			case channel <- message.Argument:
+			case <-ctx.Done():
+				return
 			}
 		}
-	}()
+	}
+}
+
+// watchPort polls port list until port disappears, and reports it to lost. Main loop closes the port.
+// Port list is polled only if there are no hotplug events, main loop handles those itself.
+func watchPort(ctx context.Context, portName string, lost chan<- error) {
+	for {
+		var poll <-chan time.Time
+		var stopped <-chan struct{}
+		if hotplugRunning.Load() {
+			stopped = hotplugStopped
+		} else {
+			poll = time.After(timeConnectCheck * time.Second)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-stopped:
+			continue
+		case <-poll:
+		}
+
+		portsNames, err := serial.GetPortsList()
+		if err != nil {
+			lost <- fmt.Errorf("failed to get ports: %w", err)
+			return
+		}
+		if !slices.Contains(portsNames, portName) {
+			lost <- fmt.Errorf("port %s does not exist", portName)
+			return
+		}
+	}
+}
+
+// shutdown sends pending notifications, says goodbye to the badge and closes the port.
+func shutdown(port serial.Port) {
+	throttler.Flush()
+	if port == nil {
+		return
+	}
+
+	deadline := time.Now().Add(timeShutdown * time.Second)
+flush:
+	for !paused && time.Now().Before(deadline) {
+		select {
+		case badgeNotification := <-throttler.Out():
+			if _, err := sendNotification(port, badgeNotification); err != nil {
+				log(logz.LogErr, "failed to flush notification", err)
+				break flush
+			}
+			metrics.NotificationsSent.Inc()
+		default:
+			break flush
+		}
+	}
+
+	if _, err := port.Write(protocol.AppendCommand(nil, protocol.CommandBye)); err != nil {
+		log(logz.LogWarn, "failed to say goodbye to the badge", err)
+	} else {
+		// Give some time to Gopher Badge to process message.
+		time.Sleep(timeSender * time.Millisecond)
+	}
+	if err := port.Close(); err != nil {
+		log(logz.LogWarn, "failed to close port", err)
+	}
+}
+
+// waitForReconnect requests new connection attempt after exponential backoff,
+// or as soon as the badge is plugged in.
+func waitForReconnect(ctx context.Context) {
+	delay := hotplug.Backoff(int(reconnectAttempts.Add(1))-1, timeBackoffMinimum*time.Second, timeBackoffMaximum*time.Second)
+	log(logz.LogInfo, fmt.Sprintf("reconnecting in %s...", delay))
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(delay):
+	case <-channelWake:
+	}
+	reconnect(ctx)
+}
+
+// notify sends to channel without blocking, pending signal is enough.
+func notify(channel chan struct{}) {
+	select {
+	case channel <- struct{}{}:
+	default:
+	}
+}
+
+// reconnect requests new connection attempt, unless daemon is shutting down.
+func reconnect(ctx context.Context) {
+	select {
+	case channelConnection <- true:
+	case <-ctx.Done():
+	}
 }
 
 func onExit() {
+	// Tray may exit on its own, make sure main loop is stopped as well.
+	cancel()
+	select {
+	case <-channelDone:
+	case <-time.After(2 * timeShutdown * time.Second):
+		log(logz.LogWarn, "main loop did not stop in time")
+	}
+
 	log(logz.LogInfo, "exiting...")
+	if controlServer != nil {
+		controlServer.Close()
+	}
+	if controlBus != nil {
+		controlBus.Close()
+	}
+	if apiServer != nil {
+		apiServer.Close()
+	}
+	if metricsServer != nil {
+		metricsServer.Close()
+	}
+	if notifyServer != nil {
+		if err := notifyServer.Close(); err != nil {
+			log(logz.LogErr, "failed to close notification server", err)
+		}
+	}
+	logger.Close()
+}
+
+// sendNotification completes icon and text of notification for the badge, and transmits it in parts.
+// Returns number of bytes written.
+func sendNotification(port serial.Port, badgeNotification protocol.Notification) (int, error) {
+	if badgeNotification.Icon == "" {
+		icon, err := generateIcon(badgeNotification.IconPath, badgeNotification.Program)
+		if err != nil {
+			logWith(logz.LogWarn, "failed to generate icon", logging.Fields{"program": badgeNotification.Program, "icon": badgeNotification.IconPath}, err)
+		}
+		badgeNotification.Icon = icon
+	}
+	// Bitmaps are large and slow to transmit, and block main loop meanwhile, so only text badge font can't show
+	// is rendered, within bitmapBudget.
+	if textRenderer != nil && capabilities.Bitmap && capabilities.Charset != protocol.CharsetUTF8 {
+		budget := bitmapBudget
+		if !translit.Printable(badgeNotification.Title) {
+			badgeNotification.TitleBitmap = renderBitmap(badgeNotification.Title, bitmapTitleLines, budget)
+			budget -= len(badgeNotification.TitleBitmap)
+		}
+		if !translit.Printable(badgeNotification.Body) {
+			badgeNotification.BodyBitmap = renderBitmap(badgeNotification.Body, bitmapBodyLines, budget)
+		}
+	}
+	// Text is still needed by badge, even if there are bitmaps.
+	if capabilities.Charset != protocol.CharsetUTF8 {
+		badgeNotification = transliterate(badgeNotification)
+	}
+	return writeMessage(port, protocol.AppendNotification(nil, badgeNotification))
+}
+
+// renderBitmap renders text in as many lines as fit in budget bytes, up to maximumLines.
+// Empty bitmap is returned if not even a single line fits, badge shows transliterated text then.
+func renderBitmap(text string, maximumLines, budget int) string {
+	for lines := maximumLines; lines > 0; lines-- {
+		if bitmap := textRenderer.Render(text, bitmapWidth, lines); len(bitmap) <= budget {
+			return bitmap
+		}
+	}
+	return ""
+}
+
+// sendWidget sends widget data, if badge can show the widget. Art is left out if badge already has it.
+func sendWidget(port serial.Port, widget protocol.Widget) error {
+	if !slices.Contains(capabilities.Widgets, widget.Kind) {
+		return nil
+	}
+	if widget.ArtID != "" && widget.ArtID == badgeArt[widget.Kind] {
+		widget.Art = ""
+	}
+	if capabilities.Charset != protocol.CharsetUTF8 {
+		widget.Player = translit.String(widget.Player)
+		widget.Title = translit.String(widget.Title)
+		widget.Artist = translit.String(widget.Artist)
+		widget.Album = translit.String(widget.Album)
+	}
+	bytesSent, err := writeMessage(port, protocol.AppendWidget(nil, widget))
+	metrics.BytesTransmitted.Add(uint64(bytesSent))
+	if err == nil {
+		badgeArt[widget.Kind] = widget.ArtID
+	}
+	return err
 }
 
+// writeMessage writes serialMessage in parts the badge can receive, returns number of bytes written.
+func writeMessage(port serial.Port, serialMessage []byte) (int, error) {
+	// Maximum single message length that can be transmitted to Gopher Badge is 128 bytes.
+	// If message is larger than that, end will be truncated, therefore, we are spliting message into chunks of 128 bytes.
+	serialMessageParts := [][]byte{}
+	for i := 0; i < len(serialMessage); i += messageLength {
+		end := i + messageLength
+
+		if end > len(serialMessage) {
+			end = len(serialMessage)
+		}
+
+		serialMessageParts = append(serialMessageParts, serialMessage[i:end])
+	}
+
+	// Send to serial.
+	bytesSent := 0
+	for _, serialMessagePart := range serialMessageParts {
+		n, err := port.Write(serialMessagePart)
+		bytesSent += n
+		if err != nil {
+			return bytesSent, fmt.Errorf("failed to write to port: %w", err)
+		}
+		// Give some time to Gopher Badge to process each part. Required for multipart messages.
+		time.Sleep(timePartialSender * time.Millisecond)
+	}
+	// Give some time to Gopher Badge to process message.
+	time.Sleep(timeSender * time.Millisecond)
+
+	return bytesSent, nil
+}
+
+// handshake asks the badge for its capabilities, badges that don't reply in time get ASCII only.
+func handshake(port serial.Port) protocol.Capabilities {
+	fallback := protocol.Capabilities{Charset: protocol.CharsetASCII}
+	if _, err := port.Write(protocol.AppendCommand(nil, protocol.CommandHello)); err != nil {
+		return fallback
+	}
+	if err := port.SetReadTimeout(timeRest * time.Millisecond); err != nil {
+		return fallback
+	}
+	defer port.SetReadTimeout(serial.NoTimeout)
+
+	reply := make([]byte, 0, messageLength)
+	buffer := make([]byte, messageLength)
+	deadline := time.Now().Add(timeHandshake * time.Millisecond)
+	for time.Now().Before(deadline) {
+		n, err := port.Read(buffer)
+		if err != nil {
+			return fallback
+		}
+		for _, singleByte := range buffer[:n] {
+			if singleByte != protocol.Separator {
+				reply = append(reply, singleByte)
+				continue
+			}
+			if !bytes.HasPrefix(reply, []byte("{")) {
+				// Read reports queued by the badge before it got hello.
+				reply = reply[:0]
+				continue
+			}
+			reported := protocol.Capabilities{}
+			if err := json.Unmarshal(reply, &reported); err != nil || reported.Charset == "" {
+				return fallback
+			}
+			return reported
+		}
+	}
+
+	return fallback
+}
+
+// transliterate converts text to characters badge font can show, keeping body emphasis in place.
+func transliterate(badgeNotification protocol.Notification) protocol.Notification {
+	badgeNotification.Program = translit.String(badgeNotification.Program)
+	badgeNotification.Title = translit.String(badgeNotification.Title)
+	badgeNotification.Sender = translit.String(badgeNotification.Sender)
+
+	spans := markup.ParseSpans(badgeNotification.Emphasis)
+	offsets := make([]int, 0, 2*len(spans))
+	for _, span := range spans {
+		offsets = append(offsets, span.Start, span.End)
+	}
+	badgeNotification.Body, offsets = translit.Offsets(badgeNotification.Body, offsets)
+	for i := range spans {
+		spans[i] = markup.Span{Start: offsets[2*i], End: offsets[2*i+1]}
+	}
+	badgeNotification.Emphasis = markup.FormatSpans(spans)
+
+	return badgeNotification
+}
+
+// prepareForReconnect closes port. Port is shared with main loop, so it is called only from there.
 func prepareForReconnect(log func(logz.LogLevel, string, ...error), port *serial.Port, message string, err error) {
 	log(logz.LogErr, message, err)
-	systray.SetIcon(assets.IconOffline)
-	systray.SetTooltip("Reconnecting...")
+	metrics.ReconnectAttempts.Inc()
+	setConnected(false)
 	if *port != nil {
 		(*port).Close()
 		*port = nil
 	}
-	log(logz.LogInfo, "reconnecting...")
-	time.Sleep(timeConnectCheck * time.Second)
+}
+
+// generateIcon converts icon file to image data, falling back to program letter if there is no usable icon.
+// Fallback is returned together with the error of icon file.
+func generateIcon(iconFilePath, program string) (string, error) {
+	defer metrics.IconDuration.ObserveSince(time.Now())
+	icon, err := media.GenerateImageData(iconFilePath, media.FallbackLetter(program))
+	if err != nil {
+		icon, _ = media.GenerateImageData("", media.FallbackLetter(program))
+	}
+	return icon, err
+}
+
+// renderMarkup replaces body markup with plain text, links and emphasis are kept in separate fields.
+// Only bodies from D-Bus have markup, server advertises body-markup. Others are plain text, "<" included.
+func renderMarkup(badgeNotification *protocol.Notification) {
+	text := markup.Render(badgeNotification.Body)
+	badgeNotification.Body = text.Plain
+	badgeNotification.Links = strings.Join(text.Links, " ")
+	badgeNotification.Emphasis = markup.FormatSpans(text.Emphasis)
+}
+
+// notificationID returns ID unique across daemon restarts, because badge keeps history in flash.
+func notificationID() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+func quit() {
+	cancel()
+}
+
+func status(port serial.Port) string {
+	result := "connected"
+	if port == nil {
+		result = "disconnected"
+	}
+	if paused {
+		result += ", paused"
+	}
+	unread := 0
+	for _, sentNotification := range sent {
+		if !sentNotification.Read {
+			unread++
+		}
+	}
+	if unread != 0 {
+		result += fmt.Sprintf(", %d unread", unread)
+	}
+	return result
+}
+
+// setConnected updates tray icon and tooltip, if there is a tray, and notifies control interface subscribers.
+func setConnected(isConnected bool) {
+	if controlBus != nil {
+		controlBus.EmitConnection(isConnected)
+	}
+	connected.Store(isConnected)
+	if headless {
+		return
+	}
+	if isConnected {
+		systray.SetIcon(assets.IconOnline)
+	} else {
+		systray.SetIcon(assets.IconOffline)
+	}
+	updateTooltip()
+}
+
+// updateTooltip shows connection status and metrics summary in tray tooltip.
+func updateTooltip() {
+	if headless {
+		return
+	}
+	status := "Reconnecting..."
+	if connected.Load() {
+		status = "Connected"
+	}
+	systray.SetTooltip(status + "\n" + metrics.Summary())
+}
+
+func setPaused(paused bool) {
+	if controlBus != nil {
+		controlBus.EmitPaused(paused)
+	}
+	if mPause == nil {
+		return
+	}
+	if paused {
+		mPause.Check()
+	} else {
+		mPause.Uncheck()
+	}
 }
 
 func addClearItem() *systray.MenuItem {
@@ -251,14 +1097,3 @@ func addExitItem() *systray.MenuItem {
 	mExit.Enable()
 	return mExit
 }
-
-func logFn() func(logz.LogLevel, string, ...error) {
-	log := zlog.NewConsoleLogger()
-	return func(level logz.LogLevel, msg string, errs ...error) {
-		data := map[string]any{"msg": msg}
-		if len(errs) > 0 && errs[0] != nil {
-			data["err"] = errs[0].Error()
-		}
-		log.Log(level, data)
-	}
-}
@@ -0,0 +1,182 @@
+package markup
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Text is notification body with markup rendered as plain text.
+type Text struct {
+	Plain    string
+	Links    []string // Link targets, in order of appearance, without duplicates.
+	Emphasis []Span   // Bold, italic and underlined parts of Plain.
+}
+
+// Span is a part of text, as byte offsets [Start, End).
+type Span struct {
+	Start, End int
+}
+
+// Render converts body markup, as allowed by the notification specification, to plain text.
+// Entities are decoded, line breaks kept and images replaced by their alt text. Unknown tags and comments are kept
+// as they were written, so text like "x<y" or "<nil>" is not lost.
+func Render(body string) Text {
+	text := Text{}
+	plain := strings.Builder{}
+	tokenizer := html.NewTokenizer(strings.NewReader(body))
+	emphasis, emphasisStart := 0, 0
+	href, linkStart := "", 0
+
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			// Only io.EOF is possible, reading from string. Tag left open at the end is kept as text.
+			plain.Write(tokenizer.Raw())
+			break
+		}
+
+		// Raw is only valid until Token is called.
+		raw := string(tokenizer.Raw())
+		token := tokenizer.Token()
+		switch tokenType {
+		case html.TextToken:
+			plain.WriteString(token.Data)
+		case html.CommentToken, html.DoctypeToken:
+			plain.WriteString(raw)
+		case html.StartTagToken, html.SelfClosingTagToken:
+			switch token.DataAtom {
+			case atom.B, atom.I, atom.U, atom.Strong, atom.Em:
+				if tokenType == html.SelfClosingTagToken {
+					continue
+				}
+				if emphasis == 0 {
+					emphasisStart = plain.Len()
+				}
+				emphasis++
+			case atom.A:
+				href, linkStart = attribute(token, "href"), plain.Len()
+				text.addLink(href)
+			case atom.Img:
+				if alt := attribute(token, "alt"); alt != "" {
+					plain.WriteString("[" + alt + "]")
+				}
+			case atom.Br:
+				plain.WriteString("\n")
+			default:
+				plain.WriteString(raw)
+			}
+		case html.EndTagToken:
+			switch token.DataAtom {
+			case atom.B, atom.I, atom.U, atom.Strong, atom.Em:
+				if emphasis == 0 {
+					continue
+				}
+				emphasis--
+				if emphasis == 0 {
+					text.addEmphasis(emphasisStart, plain.Len())
+				}
+			case atom.A:
+				// Link without text shows its target instead.
+				if plain.Len() == linkStart {
+					plain.WriteString(href)
+				}
+				href = ""
+			case atom.Br, atom.Img:
+			default:
+				plain.WriteString(raw)
+			}
+		}
+	}
+	if emphasis > 0 {
+		text.addEmphasis(emphasisStart, plain.Len())
+	}
+
+	text.Plain = plain.String()
+	text.trim()
+	return text
+}
+
+// FormatSpans encodes spans for the badge as "start-end" pairs separated by comma, e.g. "0-4,10-15".
+func FormatSpans(spans []Span) string {
+	parts := make([]string, 0, len(spans))
+	for _, span := range spans {
+		parts = append(parts, fmt.Sprintf("%d-%d", span.Start, span.End))
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseSpans decodes spans encoded with FormatSpans, invalid pairs are skipped.
+func ParseSpans(spans string) []Span {
+	result := make([]Span, 0)
+	for _, part := range strings.Split(spans, ",") {
+		start, end, ok := strings.Cut(part, "-")
+		if !ok {
+			continue
+		}
+		span := Span{}
+		var err error
+		if span.Start, err = strconv.Atoi(start); err != nil {
+			continue
+		}
+		if span.End, err = strconv.Atoi(end); err != nil || span.End < span.Start {
+			continue
+		}
+		result = append(result, span)
+	}
+	return result
+}
+
+func (t *Text) addLink(href string) {
+	if href == "" {
+		return
+	}
+	for _, link := range t.Links {
+		if link == href {
+			return
+		}
+	}
+	t.Links = append(t.Links, href)
+}
+
+func (t *Text) addEmphasis(start, end int) {
+	if end <= start {
+		return
+	}
+	// Adjacent spans (e.g. "<b>a</b><i>b</i>") are merged.
+	if last := len(t.Emphasis) - 1; last >= 0 && t.Emphasis[last].End == start {
+		t.Emphasis[last].End = end
+		return
+	}
+	t.Emphasis = append(t.Emphasis, Span{Start: start, End: end})
+}
+
+// trim removes surrounding white space from Plain, keeping emphasis spans in place.
+func (t *Text) trim() {
+	trimmed := strings.TrimLeft(t.Plain, " \t\r\n")
+	shift := len(t.Plain) - len(trimmed)
+	trimmed = strings.TrimRight(trimmed, " \t\r\n")
+	t.Plain = trimmed
+
+	spans := t.Emphasis[:0]
+	for _, span := range t.Emphasis {
+		span.Start = min(max(span.Start-shift, 0), len(trimmed))
+		span.End = min(max(span.End-shift, 0), len(trimmed))
+		if span.End > span.Start {
+			spans = append(spans, span)
+		}
+	}
+	t.Emphasis = spans
+}
+
+func attribute(token html.Token, name string) string {
+	for _, attr := range token.Attr {
+		if attr.Key == name {
+			return attr.Val
+		}
+	}
+	return ""
+}
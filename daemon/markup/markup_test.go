@@ -0,0 +1,64 @@
+package markup
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want Text
+	}{
+		{"plain", "hello", Text{Plain: "hello"}},
+		{"emphasis", "a <b>bold</b> c", Text{Plain: "a bold c", Emphasis: []Span{{2, 6}}}},
+		{"nested emphasis", "<b>a<i>b</i>c</b>d", Text{Plain: "abcd", Emphasis: []Span{{0, 3}}}},
+		{"adjacent emphasis", "<b>a</b><i>b</i> c", Text{Plain: "ab c", Emphasis: []Span{{0, 2}}}},
+		{"separate emphasis", "<u>a</u> <em>b</em>", Text{Plain: "a b", Emphasis: []Span{{0, 1}, {2, 3}}}},
+		{"unclosed emphasis", "a <strong>b", Text{Plain: "a b", Emphasis: []Span{{2, 3}}}},
+		{"stray end tag", "a</b> b", Text{Plain: "a b"}},
+		{"emphasis offsets in bytes", "ž<b>é</b>", Text{Plain: "žé", Emphasis: []Span{{2, 4}}}},
+		{"emphasis after trim", "  <b>a</b> ", Text{Plain: "a", Emphasis: []Span{{0, 1}}}},
+		{"link", `see <a href="https://go.dev">Go</a>`, Text{Plain: "see Go", Links: []string{"https://go.dev"}}},
+		{"link without text", `<a href="https://go.dev"></a>`, Text{Plain: "https://go.dev", Links: []string{"https://go.dev"}}},
+		{"link without href", `<a>text</a>`, Text{Plain: "text"}},
+		{"duplicate links", `<a href="u">a</a> <a href="u">b</a>`, Text{Plain: "a b", Links: []string{"u"}}},
+		{"entities", "&amp; &lt;b&gt; &quot;&#39;&#x263A;", Text{Plain: `& <b> "'☺`}},
+		{"image alt", `<img src="x.png" alt="cat"/> meow`, Text{Plain: "[cat] meow"}},
+		{"image without alt", `<img src="x.png"> meow`, Text{Plain: "meow"}},
+		{"line break", "a<br>b<br/>c", Text{Plain: "a\nb\nc"}},
+		{"stray less than", "x<y", Text{Plain: "x<y"}},
+		{"less than with space", "a < b", Text{Plain: "a < b"}},
+		{"less than at end", "a <", Text{Plain: "a <"}},
+		{"unknown tag", "expected <nil>, got <p>", Text{Plain: "expected <nil>, got <p>"}},
+		{"unknown tag with emphasis", "<b><nil></b>", Text{Plain: "<nil>", Emphasis: []Span{{0, 5}}}},
+		{"comment", "a <!-- b --> c", Text{Plain: "a <!-- b --> c"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Render(test.body)
+			if got.Plain != test.want.Plain || !reflect.DeepEqual(got.Links, test.want.Links) || !equalSpans(got.Emphasis, test.want.Emphasis) {
+				t.Errorf("Render(%q) = %+v, want %+v", test.body, got, test.want)
+			}
+		})
+	}
+}
+
+func equalSpans(a, b []Span) bool {
+	return len(a) == len(b) && (len(a) == 0 || reflect.DeepEqual(a, b))
+}
+
+func TestSpans(t *testing.T) {
+	spans := []Span{{0, 4}, {10, 15}}
+	formatted := FormatSpans(spans)
+	if formatted != "0-4,10-15" {
+		t.Errorf("FormatSpans = %q", formatted)
+	}
+	if parsed := ParseSpans(formatted); !reflect.DeepEqual(parsed, spans) {
+		t.Errorf("ParseSpans(%q) = %v, want %v", formatted, parsed, spans)
+	}
+	if parsed := ParseSpans("1-2,x-3,5-4,7,8-9"); !reflect.DeepEqual(parsed, []Span{{1, 2}, {8, 9}}) {
+		t.Errorf("ParseSpans skipped wrong pairs: %v", parsed)
+	}
+}
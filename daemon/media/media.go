@@ -1,14 +1,15 @@
 package media
 
 import (
+	"bytes"
 	"fmt"
 	"image"
 	"image/color"
-	"image/draw"
 	"image/jpeg"
 	"image/png"
-	"log"
 	"os"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/fogleman/gg"
 	"github.com/gabriel-vasile/mimetype"
@@ -23,46 +24,41 @@ const (
 	width, height = 30, 30
 )
 
-func GenerateImageData(iconFilePath, iconFallback string) string {
-	imageData := ""
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
-
+// GenerateImageData converts icon file to hex encoded RGB pixels, ready to be sent to the badge.
+// Without icon file, fallback letter is drawn instead.
+func GenerateImageData(iconFilePath, iconFallback string) (string, error) {
 	if iconFilePath == "" {
 		decodedImage, err := charToImg(iconFallback)
 		if err != nil {
-			log.Fatalln(err)
+			return "", err
 		}
+		return hexPixels(decodedImage, width), nil
+	}
 
-		decodedImage = resize.Resize(width, height, decodedImage, resize.Lanczos3)
-		draw.Draw(img, img.Bounds(), decodedImage, decodedImage.Bounds().Min, draw.Src)
-
-		colors := make([]color.RGBA, 0)
-		for y := 0; y < img.Bounds().Max.Y; y++ {
-			for x := 0; x < img.Bounds().Max.X; x++ {
-				r, g, b, _ := img.At(x, y).RGBA()
-				colors = append(colors, color.RGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: uint8(255)})
-			}
-		}
+	iconData, err := os.ReadFile(iconFilePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read icon: %w", err)
+	}
 
-		for _, c := range colors {
-			imageData += fmt.Sprintf("%02x%02x%02x", c.R, c.G, c.B)
-		}
+	return GenerateImageDataFromBytes(iconData, iconFallback)
+}
 
-		return imageData
+// GenerateImageDataFromBytes works like GenerateImageData, but with already loaded icon file content.
+func GenerateImageDataFromBytes(iconData []byte, iconFallback string) (string, error) {
+	if len(iconData) == 0 {
+		return GenerateImageData("", iconFallback)
 	}
 
-	file, err := os.Open(iconFilePath)
-	if err != nil {
-		return imageData
-	}
+	imageData := ""
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	file := bytes.NewReader(iconData)
 
-	mtype, err := mimetype.DetectFile(iconFilePath)
-	fmt.Println(mtype.String(), mtype.Extension())
+	mtype := mimetype.Detect(iconData)
 	switch mtype.String() {
 	case "image/svg+xml":
 		icon, err := oksvg.ReadIconStream(file)
 		if err != nil {
-			return imageData
+			return imageData, fmt.Errorf("failed to decode %s icon: %w", mtype, err)
 		}
 		icon.SetTarget(0, 0, float64(width), float64(height))
 		scanner := rasterx.NewScannerGV(width, height, img, img.Bounds())
@@ -96,34 +92,58 @@ func GenerateImageData(iconFilePath, iconFallback string) string {
 	case "image/jpeg":
 		decodedImage, err := jpeg.Decode(file)
 		if err != nil {
-			return imageData
+			return imageData, fmt.Errorf("failed to decode %s icon: %w", mtype, err)
 		}
-		decodedImage = resize.Resize(width, height, decodedImage, resize.Lanczos3)
-		draw.Draw(img, img.Bounds(), decodedImage, decodedImage.Bounds().Min, draw.Src)
+		return hexPixels(decodedImage, width), nil
 	case "image/png":
 		decodedImage, err := png.Decode(file)
 		if err != nil {
-			return imageData
+			return imageData, fmt.Errorf("failed to decode %s icon: %w", mtype, err)
 		}
-		decodedImage = resize.Resize(width, height, decodedImage, resize.Lanczos3)
-		draw.Draw(img, img.Bounds(), decodedImage, decodedImage.Bounds().Min, draw.Src)
+		return hexPixels(decodedImage, width), nil
 	default:
-		return imageData
+		return imageData, fmt.Errorf("unsupported icon type %s", mtype)
 	}
 
-	colors := make([]color.RGBA, 0)
-	for y := 0; y < img.Bounds().Max.Y; y++ {
-		for x := 0; x < img.Bounds().Max.X; x++ {
-			r, g, b, _ := img.At(x, y).RGBA()
-			colors = append(colors, color.RGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: uint8(255)})
-		}
+	return hexPixels(img, width), nil
+}
+
+// GenerateArtData converts JPEG or PNG album art to hex encoded RGB pixels of size x size square,
+// in the same format as icons. Art which is not square is stretched.
+func GenerateArtData(artData []byte, size int) (string, error) {
+	decodedImage, format, err := image.Decode(bytes.NewReader(artData))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode art: %w", err)
+	}
+	if format != "jpeg" && format != "png" {
+		return "", fmt.Errorf("unsupported art type %s", format)
 	}
+	return hexPixels(decodedImage, size), nil
+}
 
-	for _, c := range colors {
-		imageData += fmt.Sprintf("%02x%02x%02x", c.R, c.G, c.B)
+// hexPixels converts image, resized to size x size square unless it already is, to hex encoded RGB pixels.
+func hexPixels(src image.Image, size int) string {
+	if bounds := src.Bounds(); bounds.Dx() != size || bounds.Dy() != size {
+		src = resize.Resize(uint(size), uint(size), src, resize.Lanczos3)
 	}
+	bounds := src.Bounds()
+	imageData := make([]byte, 0, size*size*6)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			r, g, b, _ := src.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			imageData = fmt.Appendf(imageData, "%02x%02x%02x", uint8(r>>8), uint8(g>>8), uint8(b>>8))
+		}
+	}
+	return string(imageData)
+}
 
-	return imageData
+// FallbackLetter returns upper case first letter of program, drawn as its icon when it has none.
+func FallbackLetter(program string) string {
+	r, _ := utf8.DecodeRuneInString(program)
+	if r == utf8.RuneError {
+		return "A"
+	}
+	return string(unicode.ToUpper(r))
 }
 
 func charToImg(letter string) (image.Image, error) {
@@ -133,7 +153,7 @@ func charToImg(letter string) (image.Image, error) {
 	dc := gg.NewContext(width, height)
 	font, err := truetype.Parse(goregular.TTF)
 	if err != nil {
-		panic("")
+		return nil, fmt.Errorf("failed to parse font: %w", err)
 	}
 	face := truetype.NewFace(font, &truetype.Options{
 		Size: width,
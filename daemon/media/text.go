@@ -0,0 +1,173 @@
+package media
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+const (
+	textSize       = 15   // Pixels.
+	textLineHeight = 20   // Pixels. Same as line of badge font, with spacing.
+	textBaseline   = 15   // Pixels from top of the line.
+	textThreshold  = 0x80 // Alpha from which pixel is drawn, bitmaps have no anti-aliasing.
+	textEllipsis   = "…"
+)
+
+// TextRenderer draws text with TrueType fonts, as bitmaps for badge which can't show it with its own font.
+// Each rune is drawn with the first font that has it, Go font is always the last one.
+type TextRenderer struct {
+	fonts []*truetype.Font
+	faces []font.Face
+}
+
+// NewTextRenderer loads fonts in given order of preference.
+func NewTextRenderer(fontPaths ...string) (*TextRenderer, error) {
+	renderer := &TextRenderer{}
+	for _, fontPath := range fontPaths {
+		data, err := os.ReadFile(fontPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read font: %w", err)
+		}
+		if err := renderer.add(data); err != nil {
+			return nil, fmt.Errorf("failed to parse font %s: %w", fontPath, err)
+		}
+	}
+	// Go font covers Latin, Greek and Cyrillic.
+	if err := renderer.add(goregular.TTF); err != nil {
+		return nil, fmt.Errorf("failed to parse font: %w", err)
+	}
+
+	return renderer, nil
+}
+
+// Render wraps text to lines fitting width and converts each line to a bitmap strip.
+// Strip is "width,height,pixels", pixels are rows of hex encoded bits (most significant first), each row padded to full byte.
+// Strips are separated by semicolon. Text not fitting in maximumLines is cut with ellipsis.
+func (tr *TextRenderer) Render(text string, width, maximumLines int) string {
+	if strings.TrimSpace(text) == "" {
+		return ""
+	}
+	lines := tr.wrap(text, float64(width))
+	if len(lines) > maximumLines {
+		lines = lines[:maximumLines]
+		last := append(lines[maximumLines-1], []rune(textEllipsis)...)
+		for len(last) > 1 && tr.measure(last) > float64(width) {
+			last = append(last[:len(last)-2], last[len(last)-1])
+		}
+		lines[maximumLines-1] = last
+	}
+
+	strips := make([]string, 0, len(lines))
+	for _, line := range lines {
+		strips = append(strips, tr.strip(line, width))
+	}
+	return strings.Join(strips, ";")
+}
+
+func (tr *TextRenderer) add(data []byte) error {
+	parsed, err := truetype.Parse(data)
+	if err != nil {
+		return err
+	}
+	tr.fonts = append(tr.fonts, parsed)
+	tr.faces = append(tr.faces, truetype.NewFace(parsed, &truetype.Options{Size: textSize, Hinting: font.HintingFull}))
+	return nil
+}
+
+// face returns first face with glyph for r. Without any, last face draws its "missing glyph" box.
+func (tr *TextRenderer) face(r rune) font.Face {
+	for i, f := range tr.fonts {
+		if f.Index(r) != 0 {
+			return tr.faces[i]
+		}
+	}
+	return tr.faces[len(tr.faces)-1]
+}
+
+func (tr *TextRenderer) advance(r rune) float64 {
+	advance, _ := tr.face(r).GlyphAdvance(r)
+	return float64(advance) / 64
+}
+
+func (tr *TextRenderer) measure(runes []rune) float64 {
+	width := 0.0
+	for _, r := range runes {
+		width += tr.advance(r)
+	}
+	return width
+}
+
+// wrap splits text to lines, breaking at spaces if possible, otherwise (e.g. Japanese) between any runes.
+func (tr *TextRenderer) wrap(text string, width float64) [][]rune {
+	lines := make([][]rune, 0)
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := []rune{}
+		for _, word := range strings.Fields(paragraph) {
+			runes := []rune(word)
+			if len(line) > 0 && tr.measure(line)+tr.advance(' ')+tr.measure(runes) <= width {
+				line = append(append(line, ' '), runes...)
+				continue
+			}
+			if len(line) > 0 {
+				lines = append(lines, line)
+				line = []rune{}
+			}
+			for _, r := range runes {
+				if len(line) > 0 && tr.measure(line)+tr.advance(r) > width {
+					lines = append(lines, line)
+					line = []rune{}
+				}
+				line = append(line, r)
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func (tr *TextRenderer) strip(line []rune, width int) string {
+	dc := gg.NewContext(width, textLineHeight)
+	dc.SetColor(color.White)
+	x := 0.0
+	for _, r := range line {
+		dc.SetFontFace(tr.face(r))
+		dc.DrawString(string(r), x, textBaseline)
+		x += tr.advance(r)
+	}
+	img := dc.Image().(*image.RGBA)
+
+	// Strip ends with the last lit pixel, empty space is not transmitted.
+	stripWidth := 0
+	for y := 0; y < textLineHeight; y++ {
+		for x := width - 1; x >= stripWidth; x-- {
+			if img.RGBAAt(x, y).A >= textThreshold {
+				stripWidth = x + 1
+				break
+			}
+		}
+	}
+	rowBytes := (stripWidth + 7) / 8
+
+	pixels := strings.Builder{}
+	for y := 0; y < textLineHeight; y++ {
+		for i := 0; i < rowBytes; i++ {
+			value := byte(0)
+			for bit := 0; bit < 8; bit++ {
+				if x := i*8 + bit; x < stripWidth && img.RGBAAt(x, y).A >= textThreshold {
+					value |= 0x80 >> bit
+				}
+			}
+			fmt.Fprintf(&pixels, "%02x", value)
+		}
+	}
+
+	return fmt.Sprintf("%d,%d,%s", rowBytes*8, textLineHeight, pixels.String())
+}
@@ -0,0 +1,236 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coltwillcox/ngn/daemon/control"
+)
+
+const (
+	timeHeader  = 5 // Seconds.
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var (
+	NotificationsCaptured = NewCounter("ngn_notifications_captured_total", "Notifications captured from the session bus.")
+	NotificationsFiltered = NewCounterVec("ngn_notifications_filtered_total", "Notifications not sent to the badge.", "reason")
+	NotificationsSent     = NewCounter("ngn_notifications_sent_total", "Notifications sent to the badge.")
+	NotificationsFailed   = NewCounter("ngn_notifications_failed_total", "Notifications which failed to be sent to the badge.")
+	NotificationsRead     = NewCounter("ngn_notifications_read_total", "Notifications read (viewed or deleted) on the badge.")
+	SerialWriteErrors     = NewCounter("ngn_serial_write_errors_total", "Failed writes to the serial port.")
+	ReconnectAttempts     = NewCounter("ngn_reconnect_attempts_total", "Attempts to reconnect to the badge.")
+	BytesTransmitted      = NewCounter("ngn_bytes_transmitted_total", "Bytes written to the serial port.")
+	IconDuration          = NewHistogram("ngn_icon_generation_seconds", "Time spent generating notification icons.", []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1})
+
+	mutex   sync.Mutex
+	metrics []metric
+)
+
+type metric interface {
+	write(w io.Writer)
+}
+
+type Counter struct {
+	name, help string
+	value      atomic.Uint64
+}
+
+// CounterVec is a counter partitioned by values of a single label.
+type CounterVec struct {
+	name, help, label string
+	mutex             sync.Mutex
+	values            map[string]*Counter
+}
+
+type GaugeFunc struct {
+	name, help string
+	value      func() float64
+}
+
+type Histogram struct {
+	name, help string
+	mutex      sync.Mutex
+	buckets    []float64
+	counts     []uint64
+	sum        float64
+	count      uint64
+}
+
+// Server exposes metrics in Prometheus text format on "/metrics".
+type Server struct {
+	server *http.Server
+}
+
+func NewCounter(name, help string) *Counter {
+	return register(&Counter{name: name, help: help})
+}
+
+func NewCounterVec(name, help, label string) *CounterVec {
+	return register(&CounterVec{name: name, help: help, label: label, values: make(map[string]*Counter)})
+}
+
+// NewGaugeFunc registers gauge whose value is read on every scrape.
+func NewGaugeFunc(name, help string, value func() float64) *GaugeFunc {
+	return register(&GaugeFunc{name: name, help: help, value: value})
+}
+
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return register(&Histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets))})
+}
+
+func register[T metric](m T) T {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	metrics = append(metrics, m)
+	return m
+}
+
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+func (c *Counter) Add(n uint64) {
+	c.value.Add(n)
+}
+
+func (c *Counter) Value() uint64 {
+	return c.value.Load()
+}
+
+func (c *Counter) write(w io.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	fmt.Fprintf(w, "%s %d\n", c.name, c.Value())
+}
+
+func (cv *CounterVec) With(value string) *Counter {
+	cv.mutex.Lock()
+	defer cv.mutex.Unlock()
+
+	counter, ok := cv.values[value]
+	if !ok {
+		counter = &Counter{name: cv.name}
+		cv.values[value] = counter
+	}
+	return counter
+}
+
+// Value returns sum over all label values.
+func (cv *CounterVec) Value() uint64 {
+	cv.mutex.Lock()
+	defer cv.mutex.Unlock()
+
+	sum := uint64(0)
+	for _, counter := range cv.values {
+		sum += counter.Value()
+	}
+	return sum
+}
+
+func (cv *CounterVec) write(w io.Writer) {
+	cv.mutex.Lock()
+	defer cv.mutex.Unlock()
+
+	writeHeader(w, cv.name, cv.help, "counter")
+	values := make([]string, 0, len(cv.values))
+	for value := range cv.values {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	for _, value := range values {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", cv.name, cv.label, value, cv.values[value].Value())
+	}
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %g\n", g.name, g.value())
+}
+
+func (h *Histogram) Observe(value float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for i, bucket := range h.buckets {
+		if value <= bucket {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// ObserveSince records time elapsed since start, in seconds.
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	for i, bucket := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", h.name, bucket, h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %g\n", h.name, h.sum)
+	fmt.Fprintf(w, "%s_count %d\n", h.name, h.count)
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// WriteText writes all registered metrics in Prometheus text format.
+func WriteText(w io.Writer) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// Summary returns short, human readable overview, e.g. for tray tooltip.
+func Summary() string {
+	return fmt.Sprintf("Sent %d, failed %d, filtered %d", NotificationsSent.Value(), NotificationsFailed.Value(), NotificationsFiltered.Value())
+}
+
+// Listen serves metrics on loopback "host:port".
+func Listen(address string) (*Server, error) {
+	listener, err := control.ListenLoopback(address)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		builder := &strings.Builder{}
+		WriteText(builder)
+		io.WriteString(w, builder.String())
+	})
+	s := &Server{
+		server: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: timeHeader * time.Second,
+		},
+	}
+	go s.server.Serve(listener)
+
+	return s, nil
+}
+
+func (s *Server) Close() error {
+	return s.server.Shutdown(context.Background())
+}
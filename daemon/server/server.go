@@ -0,0 +1,208 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+)
+
+const (
+	name                = "org.freedesktop.Notifications"
+	path                = "/org/freedesktop/Notifications"
+	timeExpire          = 10000 // Milliseconds. Used when client leaves expiration to the server.
+	reasonExpired       = 1
+	reasonClosed        = 3
+	reasonUndefined     = 4
+	maximumPersistent   = 256 // Notifications which never expire, the oldest are forgotten over it.
+	serverName          = "ngn"
+	serverVendor        = "coltwillcox"
+	serverVersion       = "1.0"
+	serverSpecVersion   = "1.2"
+	signalClosed        = name + ".NotificationClosed"
+	errorNotFound       = name + ".Error.NotFound"
+	introspectInterface = `
+	<interface name="` + name + `">
+		<method name="Notify">
+			<arg name="app_name" type="s" direction="in"/>
+			<arg name="replaces_id" type="u" direction="in"/>
+			<arg name="app_icon" type="s" direction="in"/>
+			<arg name="summary" type="s" direction="in"/>
+			<arg name="body" type="s" direction="in"/>
+			<arg name="actions" type="as" direction="in"/>
+			<arg name="hints" type="a{sv}" direction="in"/>
+			<arg name="expire_timeout" type="i" direction="in"/>
+			<arg name="id" type="u" direction="out"/>
+		</method>
+		<method name="CloseNotification">
+			<arg name="id" type="u" direction="in"/>
+		</method>
+		<method name="GetCapabilities">
+			<arg name="capabilities" type="as" direction="out"/>
+		</method>
+		<method name="GetServerInformation">
+			<arg name="name" type="s" direction="out"/>
+			<arg name="vendor" type="s" direction="out"/>
+			<arg name="version" type="s" direction="out"/>
+			<arg name="spec_version" type="s" direction="out"/>
+		</method>
+		<signal name="NotificationClosed">
+			<arg name="id" type="u"/>
+			<arg name="reason" type="u"/>
+		</signal>
+		<signal name="ActionInvoked">
+			<arg name="id" type="u"/>
+			<arg name="action_key" type="s"/>
+		</signal>
+	</interface>`
+)
+
+var ErrNameTaken = errors.New("notification daemon already running")
+
+// Server owns "org.freedesktop.Notifications" name, so notifications can be sent even without other notification daemon.
+// Notify calls are captured by the listener like for any other daemon, server only has to answer them.
+type Server struct {
+	conn   *dbus.Conn
+	mutex  sync.Mutex
+	lastID uint32
+	timers map[uint32]*time.Timer // Nil for notifications which never expire.
+	// IDs of notifications which never expire, oldest first. Closed ones are removed only when they reach the front.
+	persistent []uint32
+}
+
+// New claims notifications bus name. Returns ErrNameTaken if other daemon already owns it.
+func New() (*Server, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to session bus: %w", err)
+	}
+
+	server := &Server{
+		conn:   conn,
+		timers: make(map[uint32]*time.Timer),
+	}
+
+	if err := conn.Export(server, path, name); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to export server: %w", err)
+	}
+	introspectable := introspect.Introspectable(`<node>` + introspect.IntrospectDataString + introspectInterface + `</node>`)
+	if err := conn.Export(introspectable, path, "org.freedesktop.DBus.Introspectable"); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to export introspection: %w", err)
+	}
+
+	reply, err := conn.RequestName(name, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to request name: %w", err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		conn.Close()
+		return nil, ErrNameTaken
+	}
+
+	return server, nil
+}
+
+// Close releases bus name and closes all pending notifications.
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	for id, timer := range s.timers {
+		if timer != nil {
+			timer.Stop()
+		}
+		delete(s.timers, id)
+	}
+	s.mutex.Unlock()
+
+	if _, err := s.conn.ReleaseName(name); err != nil {
+		s.conn.Close()
+		return fmt.Errorf("failed to release name: %w", err)
+	}
+	return s.conn.Close()
+}
+
+func (s *Server) Notify(appName string, replacesID uint32, appIcon, summary, body string, actions []string, hints map[string]dbus.Variant, expireTimeout int32) (uint32, *dbus.Error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := replacesID
+	timer, replaced := s.timers[id]
+	if replaced && id != 0 {
+		if timer != nil {
+			timer.Stop()
+		}
+	} else {
+		replaced = false
+		s.lastID++
+		id = s.lastID
+	}
+
+	if expireTimeout < 0 {
+		expireTimeout = timeExpire
+	}
+	if expireTimeout == 0 {
+		// Never expires, keep it only to allow closing or replacing.
+		if !replaced || timer != nil {
+			s.persistent = append(s.persistent, id)
+		}
+		s.timers[id] = nil
+		s.forgetPersistent()
+		return id, nil
+	}
+	s.timers[id] = time.AfterFunc(time.Duration(expireTimeout)*time.Millisecond, func() {
+		s.close(id, reasonExpired)
+	})
+
+	return id, nil
+}
+
+// forgetPersistent closes the oldest notifications which never expire, over maximumPersistent.
+func (s *Server) forgetPersistent() {
+	for len(s.persistent) > maximumPersistent {
+		id := s.persistent[0]
+		s.persistent = s.persistent[1:]
+		if timer, ok := s.timers[id]; ok && timer == nil {
+			delete(s.timers, id)
+			s.conn.Emit(path, signalClosed, id, reasonUndefined)
+		}
+	}
+}
+
+func (s *Server) CloseNotification(id uint32) *dbus.Error {
+	if !s.close(id, reasonClosed) {
+		return dbus.NewError(errorNotFound, []interface{}{fmt.Sprintf("notification %d not found", id)})
+	}
+	return nil
+}
+
+func (s *Server) GetCapabilities() ([]string, *dbus.Error) {
+	return []string{"body", "body-markup", "body-hyperlinks", "icon-static"}, nil
+}
+
+func (s *Server) GetServerInformation() (string, string, string, string, *dbus.Error) {
+	return serverName, serverVendor, serverVersion, serverSpecVersion, nil
+}
+
+func (s *Server) close(id uint32, reason uint32) bool {
+	s.mutex.Lock()
+	timer, ok := s.timers[id]
+	if ok {
+		if timer != nil {
+			timer.Stop()
+		}
+		delete(s.timers, id)
+	}
+	s.mutex.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	s.conn.Emit(path, signalClosed, id, reason)
+	return true
+}
@@ -0,0 +1,225 @@
+package throttle
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/coltwillcox/ngn/protocol"
+)
+
+// Config describes how notifications of a single program are limited.
+type Config struct {
+	Rate   float64       // Tokens regained per second, per program.
+	Burst  int           // Maximum number of tokens, per program.
+	Window time.Duration // Notifications over the limit are coalesced during this window.
+	Dedup  time.Duration // Notifications with identical title and body inside this window are dropped.
+}
+
+// Throttle applies per program token bucket rate limiting, burst coalescing and deduplication.
+// Notifications that pass are delivered on Out channel.
+type Throttle struct {
+	config  Config
+	mutex   sync.Mutex
+	buckets map[string]*bucket
+	groups  map[string]*group
+	seen    map[string]time.Time
+	out     chan protocol.Notification
+}
+
+// Result tells what happened to notification passed through throttle.
+type Result int
+
+const (
+	Dropped   Result = iota // Duplicate, or output is full.
+	Passed                  // Delivered on Out channel.
+	Coalesced               // Delivered later, in summary of a burst.
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type group struct {
+	count  int
+	last   protocol.Notification
+	pinned bool // Any of coalesced notifications is pinned, so summary is too.
+	timer  *time.Timer
+}
+
+func New(config Config, size int) *Throttle {
+	return &Throttle{
+		config:  config,
+		buckets: make(map[string]*bucket),
+		groups:  make(map[string]*group),
+		seen:    make(map[string]time.Time),
+		out:     make(chan protocol.Notification, size),
+	}
+}
+
+// Out returns channel with notifications ready to be transmitted.
+func (t *Throttle) Out() <-chan protocol.Notification {
+	return t.out
+}
+
+// Add passes notification through throttle.
+func (t *Throttle) Add(n protocol.Notification) Result {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.add(time.Now(), n)
+}
+
+func (t *Throttle) add(now time.Time, n protocol.Notification) Result {
+	t.prune(now)
+	key := n.Program + "\x00" + n.Title + "\x00" + n.Body
+	if _, ok := t.seen[key]; ok {
+		return Dropped
+	}
+	// Dropped notification is not remembered, so it can be retried.
+	result := t.pass(now, n)
+	if result != Dropped {
+		t.seen[key] = now
+	}
+	return result
+}
+
+// pass emits notification if program has a token left, otherwise coalesces it.
+func (t *Throttle) pass(now time.Time, n protocol.Notification) Result {
+	// Burst is already being coalesced, just count it in.
+	if g, ok := t.groups[n.Program]; ok {
+		g.count++
+		g.last = n
+		g.pinned = g.pinned || n.Pinned()
+		return Coalesced
+	}
+
+	if t.bucket(now, n.Program).take(now, t.config) {
+		if !t.emit(n) {
+			return Dropped
+		}
+		return Passed
+	}
+
+	t.groups[n.Program] = &group{
+		count:  1,
+		last:   n,
+		pinned: n.Pinned(),
+		timer:  time.AfterFunc(t.config.Window, func() { t.flush(n.Program) }),
+	}
+	return Coalesced
+}
+
+// prune forgets expired duplicates, and buckets which are full again. Full bucket is the same as a new one,
+// so state is kept only for programs that notified recently.
+func (t *Throttle) prune(now time.Time) {
+	for key, seenAt := range t.seen {
+		if now.Sub(seenAt) > t.config.Dedup {
+			delete(t.seen, key)
+		}
+	}
+	for program, b := range t.buckets {
+		if _, ok := t.groups[program]; !ok && b.full(now, t.config) {
+			delete(t.buckets, program)
+		}
+	}
+}
+
+// Flush ends all pending coalescing windows immediately, regardless of rate limits.
+// Used on shutdown, so coalesced notifications are not lost.
+func (t *Throttle) Flush() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for program, g := range t.groups {
+		g.timer.Stop()
+		delete(t.groups, program)
+		t.emit(g.summary())
+	}
+}
+
+func (t *Throttle) flush(program string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	g, ok := t.groups[program]
+	if !ok {
+		return
+	}
+
+	// Still over the limit, wait for next token.
+	now := time.Now()
+	b := t.bucket(now, program)
+	if !b.take(now, t.config) {
+		g.timer.Reset(b.wait(t.config))
+		return
+	}
+
+	// Output is full, token is returned and summary is tried again after window.
+	if !t.emit(g.summary()) {
+		b.tokens++
+		g.timer.Reset(t.config.Window)
+		return
+	}
+	delete(t.groups, program)
+}
+
+// summary returns coalesced notification, or the only one if there was no burst.
+func (g *group) summary() protocol.Notification {
+	if g.count == 1 {
+		return g.last
+	}
+
+	summary := g.last
+	summary.Title = fmt.Sprintf("%d new messages", g.count)
+	summary.Body = g.last.Title
+	summary.Emphasis = "" // Refers to original body.
+	if g.pinned {
+		summary.Sticky = protocol.StickyTrue
+	}
+	return summary
+}
+
+func (t *Throttle) emit(n protocol.Notification) bool {
+	select {
+	case t.out <- n:
+		return true
+	default:
+		return false
+	}
+}
+
+func (t *Throttle) bucket(now time.Time, program string) *bucket {
+	b, ok := t.buckets[program]
+	if !ok {
+		b = &bucket{tokens: float64(t.config.Burst), updated: now}
+		t.buckets[program] = b
+	}
+	return b
+}
+
+func (b *bucket) take(now time.Time, config Config) bool {
+	b.tokens += now.Sub(b.updated).Seconds() * config.Rate
+	if b.tokens > float64(config.Burst) {
+		b.tokens = float64(config.Burst)
+	}
+	b.updated = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *bucket) full(now time.Time, config Config) bool {
+	return b.tokens+now.Sub(b.updated).Seconds()*config.Rate >= float64(config.Burst)
+}
+
+func (b *bucket) wait(config Config) time.Duration {
+	if config.Rate <= 0 {
+		return config.Window
+	}
+	return time.Duration((1 - b.tokens) / config.Rate * float64(time.Second))
+}
@@ -0,0 +1,203 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coltwillcox/ngn/protocol"
+)
+
+// Window is long enough that coalescing timers never fire during tests, groups are ended with Flush.
+var config = Config{Rate: 1, Burst: 2, Window: time.Hour, Dedup: 10 * time.Second}
+
+func notification(program, title string) protocol.Notification {
+	return protocol.Notification{Program: program, Title: title, Body: title + " body"}
+}
+
+// received returns notifications waiting in output.
+func received(t *Throttle) []protocol.Notification {
+	var notifications []protocol.Notification
+	for len(t.out) > 0 {
+		notifications = append(notifications, <-t.out)
+	}
+	return notifications
+}
+
+func TestBurst(t *testing.T) {
+	th := New(config, 10)
+	now := time.Now()
+	for i, want := range []Result{Passed, Passed, Coalesced} {
+		if result := th.add(now, notification("p", string(rune('a'+i)))); result != want {
+			t.Errorf("notification %d result = %d, want %d", i, result, want)
+		}
+	}
+	// Other program has its own bucket.
+	th.add(now, notification("q", "a"))
+
+	got := received(th)
+	if len(got) != 3 || got[0].Title != "a" || got[1].Title != "b" || got[2].Program != "q" {
+		t.Fatalf("got %+v, want burst of p and q", got)
+	}
+	if _, ok := th.groups["p"]; !ok {
+		t.Error("notification over burst is not coalesced")
+	}
+	th.Flush()
+}
+
+func TestRefill(t *testing.T) {
+	now := time.Now()
+	b := &bucket{tokens: 0, updated: now}
+	if b.take(now.Add(500*time.Millisecond), config) {
+		t.Error("token taken after half of refill time")
+	}
+	if !b.take(now.Add(time.Second), config) {
+		t.Error("token not refilled after a second")
+	}
+	if b.full(now.Add(2*time.Second), config) {
+		t.Error("bucket full after a token of refill")
+	}
+	if !b.full(now.Add(3*time.Second), config) {
+		t.Error("bucket not full after two tokens of refill")
+	}
+
+	// Refill is capped at burst.
+	b.take(now.Add(time.Hour), config)
+	if b.tokens != float64(config.Burst-1) {
+		t.Errorf("tokens after long refill = %f, want %d", b.tokens, config.Burst-1)
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	th := New(config, 10)
+	now := time.Now()
+	for _, title := range []string{"a", "b", "c", "d", "e"} {
+		th.add(now, notification("p", title))
+	}
+	received(th)
+
+	th.Flush()
+	got := received(th)
+	if len(got) != 1 {
+		t.Fatalf("got %+v, want single summary", got)
+	}
+	if got[0].Title != "3 new messages" || got[0].Body != "e" || got[0].Program != "p" {
+		t.Errorf("summary %+v", got[0])
+	}
+	if got[0].Sticky != "" {
+		t.Error("summary of normal notifications is sticky")
+	}
+}
+
+func TestSingleCoalesced(t *testing.T) {
+	th := New(config, 10)
+	now := time.Now()
+	for _, title := range []string{"a", "b", "c"} {
+		th.add(now, notification("p", title))
+	}
+	received(th)
+
+	th.Flush()
+	if got := received(th); len(got) != 1 || got[0] != notification("p", "c") {
+		t.Errorf("got %+v, want the only coalesced notification unchanged", got)
+	}
+}
+
+func TestPinnedSummary(t *testing.T) {
+	tests := []struct {
+		name   string
+		pinned protocol.Notification
+	}{
+		{"critical", protocol.Notification{Program: "p", Title: "critical", Urgency: protocol.UrgencyCritical}},
+		{"sticky", protocol.Notification{Program: "p", Title: "sticky", Sticky: protocol.StickyTrue}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			th := New(config, 10)
+			now := time.Now()
+			th.add(now, notification("p", "a"))
+			th.add(now, notification("p", "b"))
+			th.add(now, test.pinned)
+			th.add(now, notification("p", "c"))
+			received(th)
+
+			th.Flush()
+			got := received(th)
+			if len(got) != 1 || got[0].Sticky != protocol.StickyTrue {
+				t.Errorf("got %+v, want sticky summary", got)
+			}
+		})
+	}
+}
+
+func TestDedup(t *testing.T) {
+	th := New(Config{Rate: 100, Burst: 100, Window: time.Hour, Dedup: 10 * time.Second}, 10)
+	now := time.Now()
+	if th.add(now, notification("p", "a")) == Dropped {
+		t.Fatal("first notification dropped")
+	}
+	if th.add(now.Add(5*time.Second), notification("p", "a")) != Dropped {
+		t.Error("duplicate inside window passed")
+	}
+	if th.add(now.Add(5*time.Second), notification("q", "a")) == Dropped {
+		t.Error("same text of other program dropped")
+	}
+	if th.add(now.Add(11*time.Second), notification("p", "a")) == Dropped {
+		t.Error("duplicate after window dropped")
+	}
+	if got := received(th); len(got) != 3 {
+		t.Errorf("got %+v, want 3 notifications", got)
+	}
+}
+
+func TestFullOutput(t *testing.T) {
+	th := New(Config{Rate: 100, Burst: 100, Window: time.Hour, Dedup: time.Hour}, 1)
+	now := time.Now()
+	th.add(now, notification("p", "a"))
+	if th.add(now, notification("p", "b")) != Dropped {
+		t.Error("notification passed to full output")
+	}
+	received(th)
+
+	// Dropped notification is not remembered as duplicate, so it can be retried.
+	if th.add(now, notification("p", "b")) == Dropped {
+		t.Error("retried notification dropped")
+	}
+}
+
+func TestFlushFullOutput(t *testing.T) {
+	th := New(Config{Rate: 1, Burst: 1, Window: time.Hour, Dedup: time.Hour}, 1)
+	now := time.Now()
+	for _, title := range []string{"a", "b", "c"} {
+		th.add(now, notification("p", title))
+	}
+
+	// Window ends with a token refilled, while output is still full. Summary is kept for the next window.
+	th.buckets["p"].updated = now.Add(-time.Second)
+	th.flush("p")
+	if _, ok := th.groups["p"]; !ok {
+		t.Fatal("summary lost on full output")
+	}
+	received(th)
+
+	th.buckets["p"].updated = now.Add(-time.Second)
+	th.flush("p")
+	if got := received(th); len(got) != 1 || got[0].Title != "2 new messages" {
+		t.Errorf("got %+v, want summary", got)
+	}
+	if _, ok := th.groups["p"]; ok {
+		t.Error("group kept after its summary was sent")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	th := New(config, 10)
+	now := time.Now()
+	th.add(now, notification("p", "a"))
+	th.add(now.Add(time.Hour), notification("q", "a"))
+	if _, ok := th.buckets["p"]; ok {
+		t.Error("refilled bucket not pruned")
+	}
+	if len(th.seen) != 1 {
+		t.Errorf("seen %v, want only the last notification", th.seen)
+	}
+}
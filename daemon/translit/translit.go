@@ -0,0 +1,168 @@
+package translit
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Replacement is shown instead of characters that can't be transliterated.
+const Replacement = "?"
+
+// String converts text to printable ASCII, the only characters badge font has glyphs for.
+func String(text string) string {
+	result, _ := Offsets(text, nil)
+	return result
+}
+
+// Offsets works like String, additionally moving byte offsets of text (e.g. emphasis spans) to matching offsets in result.
+func Offsets(text string, offsets []int) (string, []int) {
+	moved := make([]int, len(offsets))
+	order := make([]int, len(offsets))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return offsets[order[a]] < offsets[order[b]] })
+
+	result := strings.Builder{}
+	next := 0
+	for i, r := range text {
+		for ; next < len(order) && offsets[order[next]] <= i; next++ {
+			moved[order[next]] = result.Len()
+		}
+		result.WriteString(transliterate(r))
+	}
+	for ; next < len(order); next++ {
+		moved[order[next]] = result.Len()
+	}
+
+	return result.String(), moved
+}
+
+// Printable reports whether badge font has glyphs for all characters of text, so String keeps it as it is.
+func Printable(text string) bool {
+	for _, r := range text {
+		if transliterate(r) != string(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func transliterate(r rune) string {
+	switch {
+	case r == '\n':
+		return "\n"
+	case r == '\t':
+		return " "
+	case r >= ' ' && r <= '~':
+		return string(r)
+	case ignored(r):
+		return ""
+	}
+
+	if replacement, ok := symbols[r]; ok {
+		return replacement
+	}
+	if replacement, ok := emoji[r]; ok {
+		return replacement
+	}
+	if replacement, ok := cyrillic[unicode.ToLower(r)]; ok {
+		if unicode.IsUpper(r) && replacement != "" {
+			return strings.ToUpper(replacement[:1]) + replacement[1:]
+		}
+		return replacement
+	}
+
+	// Accented Latin letters lose their accents (é -> e).
+	base := strings.Builder{}
+	for _, decomposed := range norm.NFD.String(string(r)) {
+		if unicode.Is(unicode.Mn, decomposed) {
+			continue
+		}
+		if decomposed < ' ' || decomposed > '~' {
+			return Replacement
+		}
+		base.WriteRune(decomposed)
+	}
+	if base.Len() == 0 {
+		return Replacement
+	}
+	return base.String()
+}
+
+// ignored reports invisible characters: control characters, combining marks,
+// emoji variation selectors, joiners and skin tone modifiers.
+func ignored(r rune) bool {
+	return unicode.IsControl(r) ||
+		unicode.Is(unicode.Mn, r) ||
+		r == '\u200b' || r == '\u200c' || r == '\u200d' || r == '\ufeff' ||
+		(r >= '\ufe00' && r <= '\ufe0f') ||
+		(r >= 0x1f3fb && r <= 0x1f3ff)
+}
+
+var symbols = map[rune]string{
+	'\u00a0': " ", '\u2002': " ", '\u2003': " ", '\u2009': " ", '\u202f': " ",
+	'‘': "'", '’': "'", '‚': "'", '‛': "'", '′': "'",
+	'“': "\"", '”': "\"", '„': "\"", '‟': "\"", '″': "\"",
+	'«': "<<", '»': ">>", '‹': "<", '›': ">",
+	'‐': "-", '‑': "-", '‒': "-", '–': "-", '—': "-", '―': "-", '−': "-",
+	'…': "...", '•': "*", '·': ".", '×': "x", '÷': "/", '±': "+/-",
+	'°': "deg", '©': "(c)", '®': "(r)", '™': "(tm)", '§': "S", '¶': "P",
+	'€': "EUR", '£': "GBP", '¥': "JPY", '¢': "c", '₽': "RUB", '₿': "BTC",
+	'←': "<-", '→': "->", '↑': "^", '↓': "v", '⇒': "=>", '⇐': "<=", '↔': "<->",
+	'≤': "<=", '≥': ">=", '≠': "!=", '≈': "~",
+	'½': "1/2", '¼': "1/4", '¾': "3/4",
+	'¡': "!", '¿': "?",
+	'ß': "ss", 'ẞ': "SS", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE",
+	'ø': "o", 'Ø': "O", 'đ': "dj", 'Đ': "Dj", 'ł': "l", 'Ł': "L",
+	'þ': "th", 'Þ': "Th", 'ð': "d", 'Ð': "D", 'ı': "i", 'ħ': "h", 'Ħ': "H",
+}
+
+// cyrillic covers Russian, Ukrainian, Belarusian and Serbian alphabets, lowercase only.
+var cyrillic = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "j", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "h", 'ц': "c",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'ђ': "dj", 'ј': "j", 'љ': "lj", 'њ': "nj", 'ћ': "c", 'џ': "dz",
+	'є': "ye", 'і': "i", 'ї': "yi", 'ґ': "g", 'ў': "u",
+}
+
+var emoji = map[rune]string{
+	'😀': ":grinning:", '😃': ":smiley:", '😄': ":smile:", '😁': ":grin:", '😆': ":laughing:",
+	'😅': ":sweat_smile:", '🤣': ":rofl:", '😂': ":joy:", '🙂': ":slightly_smiling_face:", '🙃': ":upside_down_face:",
+	'😉': ":wink:", '😊': ":blush:", '😇': ":innocent:", '😍': ":heart_eyes:", '😘': ":kissing_heart:",
+	'😋': ":yum:", '😛': ":stuck_out_tongue:", '😜': ":stuck_out_tongue_winking_eye:", '🤔': ":thinking:", '🤐': ":zipper_mouth:",
+	'😐': ":neutral_face:", '😑': ":expressionless:", '😶': ":no_mouth:", '😏': ":smirk:", '😒': ":unamused:",
+	'🙄': ":roll_eyes:", '😬': ":grimacing:", '😌': ":relieved:", '😔': ":pensive:", '😪': ":sleepy:",
+	'😴': ":sleeping:", '😷': ":mask:", '🤒': ":face_with_thermometer:", '🤯': ":exploding_head:", '😎': ":sunglasses:",
+	'🤓': ":nerd_face:", '😕': ":confused:", '😟': ":worried:", '🙁': ":slightly_frowning_face:", '😮': ":open_mouth:",
+	'😲': ":astonished:", '😳': ":flushed:", '😢': ":cry:", '😭': ":sob:", '😱': ":scream:",
+	'😡': ":rage:", '😠': ":angry:", '🤬': ":cursing_face:", '💀': ":skull:", '💩': ":poop:",
+	'🤡': ":clown_face:", '👻': ":ghost:", '👽': ":alien:", '🤖': ":robot:", '😺': ":smiley_cat:",
+	'👋': ":wave:", '👌': ":ok_hand:", '✌': ":v:", '🤞': ":crossed_fingers:", '👍': ":+1:",
+	'👎': ":-1:", '👏': ":clap:", '🙌': ":raised_hands:", '🙏': ":pray:", '💪': ":muscle:",
+	'👀': ":eyes:", '🧠': ":brain:", '❤': ":heart:", '💔': ":broken_heart:", '💕': ":two_hearts:",
+	'💯': ":100:", '💥': ":boom:", '💬': ":speech_balloon:", '💤': ":zzz:", '✨': ":sparkles:",
+	'🔥': ":fire:", '⭐': ":star:", '🌟': ":star2:", '☀': ":sunny:", '☁': ":cloud:",
+	'🌧': ":cloud_with_rain:", '⛄': ":snowman:", '⚡': ":zap:", '🌈': ":rainbow:", '🌙': ":crescent_moon:",
+	'🎉': ":tada:", '🎊': ":confetti_ball:", '🎁': ":gift:", '🎂': ":birthday:", '🎵': ":musical_note:",
+	'🎶': ":notes:", '🎮': ":video_game:", '🏆': ":trophy:", '⚽': ":soccer:", '🚀': ":rocket:",
+	'🚗': ":car:", '✈': ":airplane:", '🏠': ":house:", '☕': ":coffee:", '🍺': ":beer:",
+	'🍕': ":pizza:", '🍔': ":hamburger:", '🐛': ":bug:", '🐞': ":beetle:", '🐶': ":dog:",
+	'🐱': ":cat:", '🦀': ":crab:", '🐍': ":snake:", '🦄': ":unicorn:", '🌍': ":earth_africa:",
+	'📅': ":date:", '📆': ":calendar:", '📧': ":email:", '📨': ":incoming_envelope:", '📩': ":envelope_with_arrow:",
+	'📞': ":telephone_receiver:", '📱': ":iphone:", '💻': ":computer:", '⌨': ":keyboard:", '🖥': ":desktop_computer:",
+	'📁': ":file_folder:", '📄': ":page_facing_up:", '📝': ":memo:", '📌': ":pushpin:", '📎': ":paperclip:",
+	'🔒': ":lock:", '🔓': ":unlock:", '🔑': ":key:", '🔔': ":bell:", '🔕': ":no_bell:",
+	'🔗': ":link:", '🔍': ":mag:", '⏰': ":alarm_clock:", '⏳': ":hourglass_flowing_sand:", '⌛': ":hourglass:",
+	'✅': ":white_check_mark:", '✔': ":heavy_check_mark:", '❌': ":x:", '❗': ":exclamation:", '❓': ":question:",
+	'⚠': ":warning:", '⛔': ":no_entry:", '🚫': ":no_entry_sign:", '🆕': ":new:", '🆗': ":ok:",
+	'🔴': ":red_circle:", '🟢': ":green_circle:", '🟡': ":yellow_circle:", '🔵': ":large_blue_circle:", '⚪': ":white_circle:",
+	'➡': ":arrow_right:", '⬅': ":arrow_left:", '⬆': ":arrow_up:", '⬇': ":arrow_down:", '🔄': ":arrows_counterclockwise:",
+	'💰': ":moneybag:", '💸': ":money_with_wings:", '📈': ":chart_with_upwards_trend:", '📉': ":chart_with_downwards_trend:", '🛠': ":hammer_and_wrench:",
+	'🤝': ":handshake:", '🫡': ":saluting_face:", '🥳': ":partying_face:", '🥲': ":smiling_face_with_tear:",
+}
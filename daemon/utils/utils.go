@@ -3,6 +3,10 @@ package utils
 import (
 	"errors"
 	"os"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/coltwillcox/ngn/protocol"
 )
 
 func ExtractFilePath(inputs []interface{}) string {
@@ -24,3 +28,44 @@ func ExtractFilePath(inputs []interface{}) string {
 
 	return filePath
 }
+
+// ExtractUrgency reads urgency from notification hints, defaults to normal.
+func ExtractUrgency(inputs []interface{}) string {
+	for _, input := range inputs {
+		hints, ok := input.(map[string]dbus.Variant)
+		if !ok {
+			continue
+		}
+		urgency, ok := hints["urgency"]
+		if !ok {
+			continue
+		}
+		switch value, _ := urgency.Value().(byte); value {
+		case 0:
+			return protocol.UrgencyLow
+		case 2:
+			return protocol.UrgencyCritical
+		}
+	}
+
+	return protocol.UrgencyNormal
+}
+
+// ExtractSticky reads "resident" hint, set for notifications which should stay until user dismisses them.
+func ExtractSticky(inputs []interface{}) string {
+	for _, input := range inputs {
+		hints, ok := input.(map[string]dbus.Variant)
+		if !ok {
+			continue
+		}
+		resident, ok := hints["resident"]
+		if !ok {
+			continue
+		}
+		if value, _ := resident.Value().(bool); value {
+			return protocol.StickyTrue
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,305 @@
+package widgets
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/coltwillcox/ngn/daemon/media"
+	"github.com/coltwillcox/ngn/protocol"
+)
+
+const (
+	mprisPrefix     = "org.mpris.MediaPlayer2."
+	mprisPath       = dbus.ObjectPath("/org/mpris/MediaPlayer2")
+	mprisPlayer     = "org.mpris.MediaPlayer2.Player"
+	propertiesIface = "org.freedesktop.DBus.Properties"
+	mprisPlaying    = "Playing"
+	mprisStopped    = "Stopped"
+	timeArt         = 5 * time.Second
+	timeCall        = time.Second // Player which doesn't answer D-Bus call in time doesn't block others.
+	maximumArtSize  = 4 << 20     // Bytes of downloaded art file.
+)
+
+// Playing reports track of MPRIS media player (org.mpris.MediaPlayer2.*) on session bus. Of several players,
+// the one which started playing last is shown, or the one paused last if none is playing.
+// Buttons on the badge control it: A play/pause, B stop, Left/Right previous/next track.
+type Playing struct {
+	actions chan string
+}
+
+// player is state of a single MPRIS player, owned by Run.
+type player struct {
+	name    string // Well-known bus name, e.g. "org.mpris.MediaPlayer2.spotify".
+	owner   string // Unique bus name, signals are sent from it.
+	status  string // MPRIS PlaybackStatus, mprisPlaying, "Paused" or mprisStopped.
+	title   string
+	artist  string
+	album   string
+	artURL  string
+	changed time.Time // Of status.
+}
+
+// art is album art converted for the badge.
+type art struct {
+	url  string
+	data string
+}
+
+func NewPlaying() *Playing {
+	return &Playing{actions: make(chan string, 4)}
+}
+
+func (p *Playing) Kind() string {
+	return protocol.WidgetPlaying
+}
+
+// Run watches players on its own session bus connection, until ctx is done.
+func (p *Playing) Run(ctx context.Context, update func(protocol.Widget)) error {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return fmt.Errorf("failed to connect to session bus: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.AddMatchSignal(dbus.WithMatchInterface(propertiesIface), dbus.WithMatchMember("PropertiesChanged"), dbus.WithMatchObjectPath(mprisPath)); err != nil {
+		return fmt.Errorf("failed to watch players: %w", err)
+	}
+	if err := conn.AddMatchSignal(dbus.WithMatchInterface("org.freedesktop.DBus"), dbus.WithMatchMember("NameOwnerChanged"), dbus.WithMatchArg0Namespace(strings.TrimSuffix(mprisPrefix, "."))); err != nil {
+		return fmt.Errorf("failed to watch players: %w", err)
+	}
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+	defer conn.RemoveSignal(signals)
+
+	load := func(name string) *player {
+		return loadPlayer(ctx, conn, name)
+	}
+	players := make(map[string]*player)
+	var names []string
+	if err := call(ctx, conn.BusObject(), "org.freedesktop.DBus.ListNames").Store(&names); err != nil {
+		return fmt.Errorf("failed to list players: %w", err)
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, mprisPrefix) {
+			players[name] = load(name)
+		}
+	}
+
+	loaded := make(chan art, 1)
+	current := art{}
+	loading := ""
+	last := protocol.Widget{}
+	for {
+		active := activePlayer(players)
+		if active != nil && active.artURL != "" && active.artURL != current.url && active.artURL != loading {
+			loading = active.artURL
+			go func(artURL string) {
+				data, _ := loadArt(artURL)
+				select {
+				case loaded <- art{url: artURL, data: data}:
+				case <-ctx.Done():
+				}
+			}(loading)
+		}
+		if widget := playingWidget(active, current); widget != last {
+			update(widget)
+			last = widget
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case signal, ok := <-signals:
+			if !ok {
+				return fmt.Errorf("session bus connection closed")
+			}
+			handleSignal(players, signal, load)
+		case a := <-loaded:
+			// Art which failed to load is not tried again, track is shown without it.
+			current, loading = a, ""
+		case action := <-p.actions:
+			if active == nil {
+				continue
+			}
+			method := ""
+			switch action {
+			case protocol.ActionToggle:
+				method = "PlayPause"
+			case protocol.ActionStop:
+				method = "Stop"
+			case protocol.ActionPrevious:
+				method = "Previous"
+			case protocol.ActionNext:
+				method = "Next"
+			default:
+				continue
+			}
+			// Player reports the result with PropertiesChanged, reply is not waited for.
+			conn.Object(active.name, mprisPath).Go(mprisPlayer+"."+method, 0, nil)
+		}
+	}
+}
+
+// Action passes action to Run, actions pressed faster than they are handled are dropped.
+func (p *Playing) Action(action string) {
+	select {
+	case p.actions <- action:
+	default:
+	}
+}
+
+// handleSignal updates players on started and stopped players and on their changed properties.
+// Started players, and players with invalidated properties, are read again with load.
+func handleSignal(players map[string]*player, signal *dbus.Signal, load func(name string) *player) {
+	switch signal.Name {
+	case "org.freedesktop.DBus.NameOwnerChanged":
+		var name, oldOwner, newOwner string
+		if err := dbus.Store(signal.Body, &name, &oldOwner, &newOwner); err != nil || !strings.HasPrefix(name, mprisPrefix) {
+			return
+		}
+		delete(players, name)
+		if newOwner != "" {
+			players[name] = load(name)
+		}
+	case propertiesIface + ".PropertiesChanged":
+		var iface string
+		var changed map[string]dbus.Variant
+		var invalidated []string
+		if err := dbus.Store(signal.Body, &iface, &changed, &invalidated); err != nil || iface != mprisPlayer {
+			return
+		}
+		for _, pl := range players {
+			if pl.owner != signal.Sender {
+				continue
+			}
+			if len(invalidated) != 0 {
+				*pl = *load(pl.name)
+				return
+			}
+			pl.set(changed)
+		}
+	}
+}
+
+// loadPlayer reads owner and all properties of player. Player which doesn't answer is kept as stopped.
+func loadPlayer(ctx context.Context, conn *dbus.Conn, name string) *player {
+	pl := &player{name: name, status: mprisStopped, changed: time.Now()}
+	call(ctx, conn.BusObject(), "org.freedesktop.DBus.GetNameOwner", name).Store(&pl.owner)
+	properties := map[string]dbus.Variant{}
+	if err := call(ctx, conn.Object(name, mprisPath), propertiesIface+".GetAll", mprisPlayer).Store(&properties); err == nil {
+		pl.set(properties)
+	}
+	return pl
+}
+
+// call calls D-Bus method, waiting for reply at most timeCall.
+func call(ctx context.Context, object dbus.BusObject, method string, args ...any) *dbus.Call {
+	ctx, cancel := context.WithTimeout(ctx, timeCall)
+	defer cancel()
+	return object.CallWithContext(ctx, method, 0, args...)
+}
+
+// set updates player with MPRIS properties, others are ignored.
+func (pl *player) set(properties map[string]dbus.Variant) {
+	if value, ok := properties["PlaybackStatus"]; ok {
+		if status, ok := value.Value().(string); ok && status != pl.status {
+			pl.status, pl.changed = status, time.Now()
+		}
+	}
+	value, ok := properties["Metadata"]
+	if !ok {
+		return
+	}
+	metadata, ok := value.Value().(map[string]dbus.Variant)
+	if !ok {
+		return
+	}
+	pl.title, _ = metadata["xesam:title"].Value().(string)
+	artists, _ := metadata["xesam:artist"].Value().([]string)
+	pl.artist = strings.Join(artists, ", ")
+	pl.album, _ = metadata["xesam:album"].Value().(string)
+	pl.artURL, _ = metadata["mpris:artUrl"].Value().(string)
+}
+
+// activePlayer returns player which started playing last, or paused last if none is playing.
+func activePlayer(players map[string]*player) *player {
+	var active *player
+	for _, pl := range players {
+		if pl.status == mprisStopped {
+			continue
+		}
+		playing, activePlaying := pl.status == mprisPlaying, active != nil && active.status == mprisPlaying
+		if active == nil || (playing && !activePlaying) || (playing == activePlaying && pl.changed.After(active.changed)) {
+			active = pl
+		}
+	}
+	return active
+}
+
+// playingWidget shows active player, with its art if it is already loaded.
+func playingWidget(active *player, current art) protocol.Widget {
+	widget := protocol.Widget{Kind: protocol.WidgetPlaying, Status: protocol.StatusStopped}
+	if active == nil {
+		return widget
+	}
+
+	widget.Status = protocol.StatusPaused
+	if active.status == mprisPlaying {
+		widget.Status = protocol.StatusRunning
+	}
+	// "org.mpris.MediaPlayer2.firefox.instance_1_23" is shown as "firefox".
+	widget.Player, _, _ = strings.Cut(strings.TrimPrefix(active.name, mprisPrefix), ".")
+	widget.Title, widget.Artist, widget.Album = active.title, active.artist, active.album
+	if active.artURL != "" && active.artURL == current.url && current.data != "" {
+		widget.Art = current.data
+		widget.ArtID = fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(current.url)))
+	}
+	return widget
+}
+
+// loadArt reads art from local file or downloads it, and converts it for the badge.
+func loadArt(artURL string) (string, error) {
+	if artURL == "" {
+		return "", nil
+	}
+	parsed, err := url.Parse(artURL)
+	if err != nil {
+		return "", err
+	}
+
+	var data []byte
+	switch parsed.Scheme {
+	case "file":
+		data, err = os.ReadFile(parsed.Path)
+	case "http", "https":
+		data, err = download(artURL)
+	default:
+		return "", fmt.Errorf("unsupported art URL %q", artURL)
+	}
+	if err != nil {
+		return "", err
+	}
+	return media.GenerateArtData(data, protocol.ArtSize)
+}
+
+func download(artURL string) ([]byte, error) {
+	client := http.Client{Timeout: timeArt}
+	response, err := client.Get(artURL)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download art: %s", response.Status)
+	}
+	return io.ReadAll(io.LimitReader(response.Body, maximumArtSize))
+}
@@ -0,0 +1,180 @@
+package widgets
+
+import (
+	"fmt"
+	"hash/crc32"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/coltwillcox/ngn/protocol"
+)
+
+const spotify = mprisPrefix + "spotify"
+
+// playingPlayer returns player in the middle of a track, which metadata updates must overwrite.
+func playingPlayer() *player {
+	return &player{name: spotify, owner: ":1.5", status: mprisPlaying, title: "old", artist: "old", album: "old", artURL: "file:///old.png"}
+}
+
+func metadata(values map[string]any) map[string]dbus.Variant {
+	metadata := map[string]dbus.Variant{}
+	for key, value := range values {
+		metadata[key] = dbus.MakeVariant(value)
+	}
+	return map[string]dbus.Variant{"Metadata": dbus.MakeVariant(metadata)}
+}
+
+func TestPlayerSet(t *testing.T) {
+	tests := []struct {
+		name       string
+		properties map[string]dbus.Variant
+		want       player
+	}{
+		{
+			"metadata",
+			metadata(map[string]any{"xesam:title": "t", "xesam:artist": []string{"a", "b"}, "xesam:album": "al", "mpris:artUrl": "file:///a.png"}),
+			player{status: mprisPlaying, title: "t", artist: "a, b", album: "al", artURL: "file:///a.png"},
+		},
+		{
+			"missing keys",
+			metadata(map[string]any{"xesam:title": "t"}),
+			player{status: mprisPlaying, title: "t"},
+		},
+		{
+			"mistyped keys",
+			metadata(map[string]any{"xesam:title": int32(1), "xesam:artist": "a", "xesam:album": []string{"al"}, "mpris:artUrl": uint8(1)}),
+			player{status: mprisPlaying},
+		},
+		{
+			"mistyped metadata",
+			map[string]dbus.Variant{"Metadata": dbus.MakeVariant("t")},
+			player{status: mprisPlaying, title: "old", artist: "old", album: "old", artURL: "file:///old.png"},
+		},
+		{
+			"status",
+			map[string]dbus.Variant{"PlaybackStatus": dbus.MakeVariant("Paused")},
+			player{status: "Paused", title: "old", artist: "old", album: "old", artURL: "file:///old.png"},
+		},
+		{
+			"mistyped status",
+			map[string]dbus.Variant{"PlaybackStatus": dbus.MakeVariant(int32(1))},
+			player{status: mprisPlaying, title: "old", artist: "old", album: "old", artURL: "file:///old.png"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pl := playingPlayer()
+			pl.set(test.properties)
+			got := player{status: pl.status, title: pl.title, artist: pl.artist, album: pl.album, artURL: pl.artURL}
+			if got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func propertiesChanged(sender, iface string, changed map[string]dbus.Variant, invalidated []string) *dbus.Signal {
+	return &dbus.Signal{Sender: sender, Name: propertiesIface + ".PropertiesChanged", Body: []any{iface, changed, invalidated}}
+}
+
+func nameOwnerChanged(name, oldOwner, newOwner string) *dbus.Signal {
+	return &dbus.Signal{Sender: "org.freedesktop.DBus", Name: "org.freedesktop.DBus.NameOwnerChanged", Body: []any{name, oldOwner, newOwner}}
+}
+
+func TestHandleSignal(t *testing.T) {
+	tests := []struct {
+		name   string
+		signal *dbus.Signal
+		loaded []string // Names loaded again.
+		status string   // Of spotify, empty if it is removed.
+		count  int      // Of players after signal.
+	}{
+		{"changed", propertiesChanged(":1.5", mprisPlayer, map[string]dbus.Variant{"PlaybackStatus": dbus.MakeVariant("Paused")}, []string{}), nil, "Paused", 1},
+		{"invalidated", propertiesChanged(":1.5", mprisPlayer, map[string]dbus.Variant{}, []string{"Metadata"}), []string{spotify}, "loaded", 1},
+		{"other sender", propertiesChanged(":1.6", mprisPlayer, map[string]dbus.Variant{"PlaybackStatus": dbus.MakeVariant("Paused")}, nil), nil, mprisPlaying, 1},
+		{"other interface", propertiesChanged(":1.5", "org.mpris.MediaPlayer2", nil, []string{"Identity"}), nil, mprisPlaying, 1},
+		{"invalid body", &dbus.Signal{Sender: ":1.5", Name: propertiesIface + ".PropertiesChanged", Body: []any{mprisPlayer}}, nil, mprisPlaying, 1},
+		{"player started", nameOwnerChanged(mprisPrefix+"vlc", "", ":1.7"), []string{mprisPrefix + "vlc"}, mprisPlaying, 2},
+		{"player restarted", nameOwnerChanged(spotify, ":1.5", ":1.8"), []string{spotify}, "loaded", 1},
+		{"player stopped", nameOwnerChanged(spotify, ":1.5", ""), nil, "", 0},
+		{"other name", nameOwnerChanged("org.example", "", ":1.9"), nil, mprisPlaying, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			players := map[string]*player{spotify: playingPlayer()}
+			var loaded []string
+			handleSignal(players, test.signal, func(name string) *player {
+				loaded = append(loaded, name)
+				return &player{name: name, status: "loaded"}
+			})
+			if !slices.Equal(loaded, test.loaded) {
+				t.Errorf("loaded %q, want %q", loaded, test.loaded)
+			}
+			status := ""
+			if pl, ok := players[spotify]; ok {
+				status = pl.status
+			}
+			if status != test.status || len(players) != test.count {
+				t.Errorf("spotify status %q of %d players, want %q of %d", status, len(players), test.status, test.count)
+			}
+		})
+	}
+}
+
+func TestActivePlayer(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		players []player
+		active  string
+	}{
+		{"none", nil, ""},
+		{"only stopped", []player{{name: "a", status: mprisStopped, changed: now}}, ""},
+		{"last started playing", []player{{name: "a", status: mprisPlaying, changed: now}, {name: "b", status: mprisPlaying, changed: now.Add(time.Second)}}, "b"},
+		{"playing before paused later", []player{{name: "a", status: mprisPlaying, changed: now}, {name: "b", status: "Paused", changed: now.Add(time.Second)}}, "a"},
+		{"last paused", []player{{name: "a", status: "Paused", changed: now.Add(time.Second)}, {name: "b", status: "Paused", changed: now}}, "a"},
+		{"stopped after playing", []player{{name: "a", status: "Paused", changed: now}, {name: "b", status: mprisStopped, changed: now.Add(time.Second)}}, "a"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			players := map[string]*player{}
+			for _, pl := range test.players {
+				players[pl.name] = &pl
+			}
+			name := ""
+			if active := activePlayer(players); active != nil {
+				name = active.name
+			}
+			if name != test.active {
+				t.Errorf("active player %q, want %q", name, test.active)
+			}
+		})
+	}
+}
+
+func TestPlayingWidget(t *testing.T) {
+	active := &player{name: mprisPrefix + "firefox.instance_1_23", status: mprisPlaying, title: "t", artist: "a", album: "al", artURL: "file:///a.png"}
+	artID := fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(active.artURL)))
+	tests := []struct {
+		name    string
+		active  *player
+		current art
+		want    protocol.Widget
+	}{
+		{"no player", nil, art{}, protocol.Widget{Kind: protocol.WidgetPlaying, Status: protocol.StatusStopped}},
+		{"art loaded", active, art{url: active.artURL, data: "data"}, protocol.Widget{Kind: protocol.WidgetPlaying, Status: protocol.StatusRunning, Player: "firefox", Title: "t", Artist: "a", Album: "al", Art: "data", ArtID: artID}},
+		{"art of previous track", active, art{url: "file:///old.png", data: "old"}, protocol.Widget{Kind: protocol.WidgetPlaying, Status: protocol.StatusRunning, Player: "firefox", Title: "t", Artist: "a", Album: "al"}},
+		{"art failed to load", active, art{url: active.artURL}, protocol.Widget{Kind: protocol.WidgetPlaying, Status: protocol.StatusRunning, Player: "firefox", Title: "t", Artist: "a", Album: "al"}},
+		{"paused", &player{name: spotify, status: "Paused"}, art{}, protocol.Widget{Kind: protocol.WidgetPlaying, Status: protocol.StatusPaused, Player: "spotify"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if widget := playingWidget(test.active, test.current); widget != test.want {
+				t.Errorf("got %+v, want %+v", widget, test.want)
+			}
+		})
+	}
+}
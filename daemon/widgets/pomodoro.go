@@ -0,0 +1,116 @@
+package widgets
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/coltwillcox/ngn/protocol"
+)
+
+// PomodoroConfig describes lengths of pomodoro phases.
+type PomodoroConfig struct {
+	Work      time.Duration
+	Break     time.Duration
+	LongBreak time.Duration
+	Rounds    int // Work phases before long break.
+}
+
+var DefaultPomodoro = PomodoroConfig{Work: 25 * time.Minute, Break: 5 * time.Minute, LongBreak: 15 * time.Minute, Rounds: 4}
+
+// Pomodoro is a work timer, controlled from the badge: A starts and pauses it, B stops it,
+// Right skips to the next phase. Phases follow each other until it is stopped.
+type Pomodoro struct {
+	config  PomodoroConfig
+	actions chan string
+}
+
+// pomodoroState is owned by Run, actions reach it through channel.
+type pomodoroState struct {
+	phase     string
+	status    string
+	round     int
+	remaining time.Duration // Of paused or stopped phase.
+	ends      time.Time     // Of running phase.
+}
+
+func NewPomodoro(config PomodoroConfig) *Pomodoro {
+	return &Pomodoro{config: config, actions: make(chan string, 4)}
+}
+
+func (p *Pomodoro) Kind() string {
+	return protocol.WidgetPomodoro
+}
+
+// Run sends widget on every change of phase or status. Badge counts remaining time down by itself.
+func (p *Pomodoro) Run(ctx context.Context, update func(protocol.Widget)) error {
+	state := pomodoroState{phase: protocol.PhaseWork, status: protocol.StatusStopped, remaining: p.config.Work}
+	var expired <-chan time.Time
+	update(state.widget())
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-expired:
+			p.next(&state)
+		case action := <-p.actions:
+			switch action {
+			case protocol.ActionToggle:
+				if state.status == protocol.StatusRunning {
+					state.remaining = time.Until(state.ends)
+					state.status = protocol.StatusPaused
+				} else {
+					state.ends = time.Now().Add(state.remaining)
+					state.status = protocol.StatusRunning
+				}
+			case protocol.ActionStop:
+				state = pomodoroState{phase: protocol.PhaseWork, status: protocol.StatusStopped, remaining: p.config.Work}
+			case protocol.ActionNext:
+				p.next(&state)
+			default:
+				continue
+			}
+		}
+		expired = nil
+		if state.status == protocol.StatusRunning {
+			expired = time.After(time.Until(state.ends))
+		}
+		update(state.widget())
+	}
+}
+
+// Action passes action to Run, actions pressed faster than they are handled are dropped.
+func (p *Pomodoro) Action(action string) {
+	select {
+	case p.actions <- action:
+	default:
+	}
+}
+
+// next switches to the following phase, counting finished work phases. Running timer keeps running.
+func (p *Pomodoro) next(state *pomodoroState) {
+	if state.phase == protocol.PhaseWork {
+		state.round++
+		state.phase, state.remaining = protocol.PhaseBreak, p.config.Break
+		if p.config.Rounds > 0 && state.round%p.config.Rounds == 0 {
+			state.remaining = p.config.LongBreak
+		}
+	} else {
+		state.phase, state.remaining = protocol.PhaseWork, p.config.Work
+	}
+	state.ends = time.Now().Add(state.remaining)
+}
+
+func (s pomodoroState) widget() protocol.Widget {
+	remaining := s.remaining
+	if s.status == protocol.StatusRunning {
+		remaining = time.Until(s.ends)
+	}
+	return protocol.Widget{
+		Kind:      protocol.WidgetPomodoro,
+		Status:    s.status,
+		Phase:     s.phase,
+		Remaining: strconv.Itoa(int(max(remaining, 0).Round(time.Second) / time.Second)),
+		Round:     strconv.Itoa(s.round),
+	}
+}
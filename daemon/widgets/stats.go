@@ -0,0 +1,151 @@
+package widgets
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coltwillcox/ngn/protocol"
+)
+
+const DefaultStatsInterval = 5 * time.Second
+
+// Stats reports CPU and memory usage, load and uptime of host, read from /proc.
+// Values which can't be read (e.g. outside of Linux) are left empty.
+type Stats struct {
+	interval time.Duration
+	idle     uint64 // CPU times at previous sample, usage is computed from their difference.
+	total    uint64
+}
+
+func NewStats(interval time.Duration) *Stats {
+	return &Stats{interval: interval}
+}
+
+func (s *Stats) Kind() string {
+	return protocol.WidgetStats
+}
+
+// Run samples stats every interval, widget is updated only when rounded values change.
+func (s *Stats) Run(ctx context.Context, update func(protocol.Widget)) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	last := protocol.Widget{}
+	for {
+		widget := s.sample()
+		if widget != last {
+			update(widget)
+			last = widget
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Action does nothing, stats have no controls.
+func (s *Stats) Action(action string) {}
+
+func (s *Stats) sample() protocol.Widget {
+	widget := protocol.Widget{Kind: protocol.WidgetStats}
+	if cpu, ok := s.cpu(); ok {
+		widget.CPU = strconv.Itoa(cpu)
+	}
+	if memory, ok := memory(); ok {
+		widget.Memory = strconv.Itoa(memory)
+	}
+	if data, err := os.ReadFile("/proc/loadavg"); err == nil {
+		if fields := strings.Fields(string(data)); len(fields) != 0 {
+			widget.Load = fields[0]
+		}
+	}
+	if data, err := os.ReadFile("/proc/uptime"); err == nil {
+		if fields := strings.Fields(string(data)); len(fields) != 0 {
+			if seconds, err := strconv.ParseFloat(fields[0], 64); err == nil {
+				widget.Uptime = formatUptime(time.Duration(seconds) * time.Second)
+			}
+		}
+	}
+	return widget
+}
+
+// cpu returns percent of CPU time spent busy since previous sample. The first sample has nothing to compare with.
+func (s *Stats) cpu() (int, bool) {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return 0, false
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, false
+	}
+	var idle, total uint64
+	for i, field := range fields[1:] {
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		total += value
+		// Idle and iowait.
+		if i == 3 || i == 4 {
+			idle += value
+		}
+	}
+
+	previousIdle, previousTotal := s.idle, s.total
+	s.idle, s.total = idle, total
+	if previousTotal == 0 || total <= previousTotal {
+		return 0, false
+	}
+	busy := (total - previousTotal) - (idle - previousIdle)
+	return int(busy * 100 / (total - previousTotal)), true
+}
+
+// memory returns percent of memory not available for new programs.
+func memory() (int, bool) {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+
+	var total, available uint64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total, _ = strconv.ParseUint(fields[1], 10, 64)
+		case "MemAvailable:":
+			available, _ = strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	if total == 0 || available > total {
+		return 0, false
+	}
+	return int((total - available) * 100 / total), true
+}
+
+// formatUptime shows the two largest units of d, e.g. "3d 4h" or "5h 12m".
+func formatUptime(d time.Duration) string {
+	days := int(d / (24 * time.Hour))
+	hours := int(d/time.Hour) % 24
+	minutes := int(d/time.Minute) % 60
+	switch {
+	case days > 0:
+		return strconv.Itoa(days) + "d " + strconv.Itoa(hours) + "h"
+	case hours > 0:
+		return strconv.Itoa(hours) + "h " + strconv.Itoa(minutes) + "m"
+	}
+	return strconv.Itoa(minutes) + "m"
+}
@@ -0,0 +1,122 @@
+// Package widgets feeds badge screens other than notification history. Every widget has a provider, which sends
+// complete widget data whenever it changes, and handles buttons pressed on the badge while widget is shown.
+package widgets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/coltwillcox/ngn/protocol"
+)
+
+var (
+	ErrUnknown = errors.New("unknown widget")
+)
+
+// Provider produces data of a single widget.
+type Provider interface {
+	// Kind returns one of protocol.Widget* constants.
+	Kind() string
+	// Run calls update with complete widget data whenever it changes, until ctx is done.
+	// Error is returned if provider can't work at all.
+	Run(ctx context.Context, update func(protocol.Widget)) error
+	// Action handles button pressed on the badge while widget is shown, one of protocol.Action* constants.
+	// It must not block.
+	Action(action string)
+}
+
+// Widgets runs providers and delivers their updates on Out channel.
+// The latest data of every widget is kept, so it can be sent again when badge reconnects.
+type Widgets struct {
+	providers map[string]Provider
+	mutex     sync.Mutex
+	latest    map[string]protocol.Widget
+	out       chan protocol.Widget
+}
+
+func New(size int, providers ...Provider) *Widgets {
+	w := &Widgets{
+		providers: make(map[string]Provider),
+		latest:    make(map[string]protocol.Widget),
+		out:       make(chan protocol.Widget, size),
+	}
+	for _, provider := range providers {
+		w.providers[provider.Kind()] = provider
+	}
+	return w
+}
+
+// Parse returns providers of comma separated widget kinds, e.g. "playing,stats". Empty string means none.
+func Parse(kinds string) ([]Provider, error) {
+	var providers []Provider
+	for _, kind := range strings.Split(kinds, ",") {
+		switch strings.TrimSpace(kind) {
+		case "":
+		case protocol.WidgetPlaying:
+			providers = append(providers, NewPlaying())
+		case protocol.WidgetStats:
+			providers = append(providers, NewStats(DefaultStatsInterval))
+		case protocol.WidgetPomodoro:
+			providers = append(providers, NewPomodoro(DefaultPomodoro))
+		default:
+			return nil, fmt.Errorf("%w %q", ErrUnknown, kind)
+		}
+	}
+	return providers, nil
+}
+
+// Start runs all providers, until ctx is done. Providers that fail are reported to failed.
+func (w *Widgets) Start(ctx context.Context, failed func(kind string, err error)) {
+	for _, provider := range w.providers {
+		go func(provider Provider) {
+			if err := provider.Run(ctx, w.update); err != nil {
+				failed(provider.Kind(), err)
+			}
+		}(provider)
+	}
+}
+
+// Out returns channel with widget updates ready to be transmitted.
+func (w *Widgets) Out() <-chan protocol.Widget {
+	return w.out
+}
+
+// Latest returns the latest data of every widget, sorted by kind.
+func (w *Widgets) Latest() []protocol.Widget {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	latest := make([]protocol.Widget, 0, len(w.latest))
+	for _, widget := range w.latest {
+		latest = append(latest, widget)
+	}
+	sort.Slice(latest, func(i, j int) bool { return latest[i].Kind < latest[j].Kind })
+	return latest
+}
+
+// Action passes button pressed on the badge to provider of widget kind.
+func (w *Widgets) Action(kind, action string) error {
+	provider, ok := w.providers[kind]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknown, kind)
+	}
+	provider.Action(action)
+	return nil
+}
+
+// update keeps widget as the latest one of its kind. Update is dropped if output is full,
+// the next one carries complete widget data anyway.
+func (w *Widgets) update(widget protocol.Widget) {
+	w.mutex.Lock()
+	w.latest[widget.Kind] = widget
+	w.mutex.Unlock()
+
+	select {
+	case w.out <- widget:
+	default:
+	}
+}
@@ -0,0 +1,66 @@
+package widgets
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/coltwillcox/ngn/protocol"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		kinds string
+		want  []string
+		err   error
+	}{
+		{"", nil, nil},
+		{"playing, stats,pomodoro", []string{protocol.WidgetPlaying, protocol.WidgetStats, protocol.WidgetPomodoro}, nil},
+		{"stats,,", []string{protocol.WidgetStats}, nil},
+		{"stats,weather", nil, ErrUnknown},
+		{"Stats", nil, ErrUnknown},
+	}
+	for _, test := range tests {
+		providers, err := Parse(test.kinds)
+		if !errors.Is(err, test.err) {
+			t.Errorf("Parse(%q) error %v, want %v", test.kinds, err, test.err)
+			continue
+		}
+		var kinds []string
+		for _, provider := range providers {
+			kinds = append(kinds, provider.Kind())
+		}
+		if !slices.Equal(kinds, test.want) {
+			t.Errorf("Parse(%q) = %q, want %q", test.kinds, kinds, test.want)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	w := New(1)
+	w.update(protocol.Widget{Kind: protocol.WidgetStats, CPU: "1"})
+	// Output is full, update is dropped instead of blocking provider, but still kept as the latest.
+	w.update(protocol.Widget{Kind: protocol.WidgetStats, CPU: "2"})
+	w.update(protocol.Widget{Kind: protocol.WidgetPlaying, Title: "t"})
+
+	if widget := <-w.Out(); widget.CPU != "1" {
+		t.Errorf("out %+v, want the first update", widget)
+	}
+	if len(w.Out()) != 0 {
+		t.Error("update over full output queued")
+	}
+	latest := w.Latest()
+	if len(latest) != 2 || latest[0].Kind != protocol.WidgetPlaying || latest[1].CPU != "2" {
+		t.Errorf("latest %+v, want the last update of every kind, sorted", latest)
+	}
+}
+
+func TestAction(t *testing.T) {
+	w := New(1, NewPomodoro(DefaultPomodoro))
+	if err := w.Action(protocol.WidgetPomodoro, protocol.ActionToggle); err != nil {
+		t.Errorf("action of pomodoro: %v", err)
+	}
+	if err := w.Action(protocol.WidgetStats, protocol.ActionToggle); !errors.Is(err, ErrUnknown) {
+		t.Errorf("action of widget not running: %v, want %v", err, ErrUnknown)
+	}
+}
@@ -6,17 +6,20 @@ require (
 	fyne.io/systray v1.11.0
 	git.sr.ht/~blallo/conductor v0.0.0-20240311235629-c5090611ec49
 	git.sr.ht/~blallo/logz/interface v0.0.0-20240316184012-0e1f424844e6
-	git.sr.ht/~blallo/logz/zlog v0.0.0-20240316184012-0e1f424844e6
 	git.sr.ht/~blallo/notilog v0.0.0-20240326103157-99ab7b61c29a
 	github.com/fogleman/gg v1.3.0
 	github.com/gabriel-vasile/mimetype v1.4.7
 	github.com/godbus/dbus/v5 v5.1.0
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
 	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
+	github.com/rs/zerolog v1.33.0
 	github.com/srwiley/oksvg v0.0.0-20221011165216-be6e8873101c
 	github.com/srwiley/rasterx v0.0.0-20220730225603-2ab79fcdd4ef
 	go.bug.st/serial v1.6.2
 	golang.org/x/image v0.0.0-20220617043117-41969df76e82
+	golang.org/x/net v0.31.0
+	golang.org/x/sys v0.27.0
+	golang.org/x/text v0.20.0
 	tinygo.org/x/drivers v0.27.0
 	tinygo.org/x/tinyfont v0.4.0
 )
@@ -26,8 +29,4 @@ require (
 	github.com/google/shlex v0.0.0-20191202100458-e7afc7fbc510 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
-	github.com/rs/zerolog v1.33.0 // indirect
-	golang.org/x/net v0.31.0 // indirect
-	golang.org/x/sys v0.27.0 // indirect
-	golang.org/x/text v0.20.0 // indirect
 )
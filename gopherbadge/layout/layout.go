@@ -0,0 +1,180 @@
+// Package layout breaks text into lines by glyph advances of badge fonts. It does not depend on badge hardware,
+// so it's tested on the host.
+package layout
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"tinygo.org/x/tinyfont"
+)
+
+const (
+	ellipsis          = "..."
+	hyphen            = "-"
+	minimumHyphenated = 3 // Runes of over-long word worth starting at the end of a line.
+)
+
+// Lines splits text into lines not wider than width pixels, measured with glyph advances of font.
+// Lines break at spaces and newlines, words wider than a line are hyphenated.
+// Returns at most maximumLines lines, and offsets where they start in text.
+func Lines(font tinyfont.Fonter, text string, width int, maximumLines int) ([]string, []int) {
+	l := lineLayout{font: font, text: text, width: width, maximumLines: maximumLines}
+	if width <= 0 || text == "" {
+		return l.lines, l.starts
+	}
+
+	paragraphStart := 0
+	for _, paragraph := range strings.Split(text, "\n") {
+		l.start, l.end, l.lineWidth, l.empty = paragraphStart, paragraphStart, 0, true
+		wordStart := paragraphStart
+		for _, word := range strings.Split(paragraph, " ") {
+			if word != "" {
+				l.addWord(wordStart, wordStart+len(word))
+			}
+			wordStart += len(word) + 1
+		}
+		l.flush("")
+		if l.full() {
+			break
+		}
+		paragraphStart += len(paragraph) + 1
+	}
+
+	return l.lines, l.starts
+}
+
+// Truncate cuts line, so it fits width pixels together with ellipsis. Never cuts inside of a rune.
+func Truncate(font tinyfont.Fonter, line string, width int) string {
+	limit := width - measure(font, ellipsis)
+	lineWidth := 0
+	for i, r := range line {
+		lineWidth += advance(font, r)
+		if lineWidth > limit {
+			return line[:i] + ellipsis
+		}
+	}
+	return line + ellipsis
+}
+
+func advance(font tinyfont.Fonter, r rune) int {
+	return int(font.GetGlyph(r).XAdvance)
+}
+
+func measure(font tinyfont.Fonter, text string) int {
+	width := 0
+	for _, r := range text {
+		width += advance(font, r)
+	}
+	return width
+}
+
+// lineLayout is the state of Lines: finished lines and the line being filled, as [start, end) of text.
+type lineLayout struct {
+	font         tinyfont.Fonter
+	text         string
+	width        int
+	maximumLines int
+	lines        []string
+	starts       []int
+	start, end   int
+	lineWidth    int
+	empty        bool
+}
+
+func (l *lineLayout) full() bool {
+	return len(l.lines) >= l.maximumLines
+}
+
+// addWord places word [start, end) of text on current line, or on the next one if it does not fit.
+func (l *lineLayout) addWord(start, end int) {
+	if l.full() {
+		return
+	}
+
+	spaceWidth := 0
+	if !l.empty {
+		// Spaces between words are kept as they are.
+		spaceWidth = measure(l.font, l.text[l.end:start])
+	}
+	wordWidth := measure(l.font, l.text[start:end])
+	if l.lineWidth+spaceWidth+wordWidth <= l.width {
+		l.place(start, end, spaceWidth+wordWidth)
+		return
+	}
+	if wordWidth <= l.width {
+		l.flush("")
+		l.addWord(start, end)
+		return
+	}
+
+	// Over-long word is hyphenated, starting on current line if a few runes fit there.
+	if !l.empty && l.lineWidth+spaceWidth+l.prefixWidth(start, minimumHyphenated)+measure(l.font, hyphen) > l.width {
+		l.flush("")
+		spaceWidth = 0
+	}
+	for start < end && !l.full() {
+		available := l.width - l.lineWidth - spaceWidth
+		if rest := measure(l.font, l.text[start:end]); rest <= available {
+			l.place(start, end, spaceWidth+rest)
+			return
+		}
+
+		cut, cutWidth, suffix := start, 0, hyphen
+		for i, r := range l.text[start:end] {
+			runeWidth := advance(l.font, r)
+			if cutWidth+runeWidth+measure(l.font, hyphen) > available {
+				break
+			}
+			cut, cutWidth = start+i+utf8.RuneLen(r), cutWidth+runeWidth
+		}
+		if cut == start {
+			if l.empty {
+				// Not even a single rune fits with hyphen, it gets a line of its own, without hyphen.
+				r, size := utf8.DecodeRuneInString(l.text[start:end])
+				cut, cutWidth, suffix = start+size, advance(l.font, r), ""
+			} else {
+				l.flush("")
+				spaceWidth = 0
+				continue
+			}
+		}
+
+		l.place(start, cut, spaceWidth+cutWidth)
+		l.flush(suffix)
+		start, spaceWidth = cut, 0
+	}
+}
+
+// place puts [start, end) of text on current line, anything between it and line content (spaces) included.
+func (l *lineLayout) place(start, end, width int) {
+	if l.empty {
+		l.start = start
+	}
+	l.end = end
+	l.lineWidth += width
+	l.empty = false
+}
+
+// flush finishes current line, with suffix (e.g. hyphen) not present in text.
+func (l *lineLayout) flush(suffix string) {
+	if l.full() {
+		return
+	}
+	l.lines = append(l.lines, l.text[l.start:l.end]+suffix)
+	l.starts = append(l.starts, l.start)
+	l.start, l.lineWidth, l.empty = l.end, 0, true
+}
+
+// prefixWidth measures first runes of text from start.
+func (l *lineLayout) prefixWidth(start int, runes int) int {
+	width := 0
+	for _, r := range l.text[start:] {
+		if runes == 0 || r == ' ' || r == '\n' {
+			break
+		}
+		width += advance(l.font, r)
+		runes--
+	}
+	return width
+}
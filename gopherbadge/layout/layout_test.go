@@ -0,0 +1,157 @@
+package layout
+
+import (
+	"slices"
+	"testing"
+	"unicode/utf8"
+
+	"tinygo.org/x/tinyfont"
+	"tinygo.org/x/tinyfont/freemono"
+)
+
+var font = &freemono.Regular9pt7b
+
+// width returns pixels taken by runes of monospaced font.
+func width(runes int) int {
+	return runes * advance(font, 'a')
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name         string
+		text         string
+		width        int // Runes.
+		maximumLines int
+		lines        []string
+		starts       []int
+	}{
+		{"empty", "", 10, 10, nil, nil},
+		{"fits", "hello world", 20, 10, []string{"hello world"}, []int{0}},
+		{"wraps at space", "hello world", 8, 10, []string{"hello", "world"}, []int{0, 6}},
+		{"wraps exactly", "hello world", 5, 10, []string{"hello", "world"}, []int{0, 6}},
+		{"keeps inner spaces", "a  b cd", 4, 10, []string{"a  b", "cd"}, []int{0, 5}},
+		{"newline", "one\ntwo", 20, 10, []string{"one", "two"}, []int{0, 4}},
+		{"empty paragraph", "a\n\nb", 20, 10, []string{"a", "", "b"}, []int{0, 2, 3}},
+		{"trailing newline", "a\n", 20, 10, []string{"a", ""}, []int{0, 2}},
+		{"hyphenates long word", "abcdefghij", 5, 10, []string{"abcd-", "efgh-", "ij"}, []int{0, 4, 8}},
+		{"hyphenates on current line", "ab cdefghijkl", 8, 10, []string{"ab cdef-", "ghijkl"}, []int{0, 7}},
+		{"moves word fitting next line", "ab cdefghij", 8, 10, []string{"ab", "cdefghij"}, []int{0, 3}},
+		{"hyphenates on next line", "ab cdefghij", 6, 10, []string{"ab", "cdefg-", "hij"}, []int{0, 3, 8}},
+		{"rune per line", "abc", 1, 10, []string{"a", "b", "c"}, []int{0, 1, 2}},
+		{"maximum lines", "a b c d", 1, 2, []string{"a", "b"}, []int{0, 2}},
+		{"maximum lines while hyphenating", "abcdefghij", 5, 2, []string{"abcd-", "efgh-"}, []int{0, 4}},
+		{"maximum lines with newlines", "a\nb\nc", 20, 2, []string{"a", "b"}, []int{0, 2}},
+		{"no width", "abc", 0, 10, nil, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines, starts := Lines(font, test.text, width(test.width), test.maximumLines)
+			if !slices.Equal(lines, test.lines) || !slices.Equal(starts, test.starts) {
+				t.Errorf("Lines(%q) = %q %v, want %q %v", test.text, lines, starts, test.lines, test.starts)
+			}
+			for _, line := range lines {
+				if measure(font, line) > width(test.width) {
+					t.Errorf("line %q wider than %d runes", line, test.width)
+				}
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		line      string
+		width     int // Runes.
+		truncated string
+	}{
+		{"hello world", 8, "hello..."},
+		{"hello", 8, "hello..."},
+		{"", 8, "..."},
+		{"hello", 3, "..."},
+	}
+	for _, test := range tests {
+		if truncated := Truncate(font, test.line, width(test.width)); truncated != test.truncated {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", test.line, test.width, truncated, test.truncated)
+		}
+	}
+}
+
+// wideFont has glyphs of any rune, CJK and emoji are twice as wide as the rest.
+type wideFont struct{}
+
+const column = 10 // Pixels, advance of narrow glyph of wideFont.
+
+func (wideFont) GetGlyph(r rune) tinyfont.Glyph {
+	if r >= 0x1100 {
+		return tinyfont.Glyph{Rune: r, XAdvance: 2 * column}
+	}
+	return tinyfont.Glyph{Rune: r, XAdvance: column}
+}
+
+func (wideFont) GetYAdvance() uint8 {
+	return 20
+}
+
+func TestLinesMultibyte(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		columns int
+		lines   []string
+		starts  []int
+	}{
+		{"accents fit", "é ž", 3, []string{"é ž"}, []int{0}},
+		{"wraps accented words", "čaša žuta", 5, []string{"čaša", "žuta"}, []int{0, 7}},
+		{"hyphenates multibyte word", "žžžžžžžžžž", 5, []string{"žžžž-", "žžžž-", "žž"}, []int{0, 8, 16}},
+		{"hyphenates after accented word", "é ščćđžščćđž", 6, []string{"é ščć-", "đžščć-", "đž"}, []int{0, 9, 19}},
+		{"wide glyphs fill line exactly", "日本 語の 😀😀", 4, []string{"日本", "語の", "😀😀"}, []int{0, 7, 14}},
+		{"wide glyph moves to next line", "aé 日b", 3, []string{"aé", "日b"}, []int{0, 4}},
+		{"hyphenates wide glyphs", "日本語のテキスト", 5, []string{"日本-", "語の-", "テキ-", "スト"}, []int{0, 6, 12, 18}},
+		{"hyphenates emoji", "😀😁😂😃", 3, []string{"😀-", "😁-", "😂-", "😃"}, []int{0, 4, 8, 12}},
+		{"newline after wide glyphs", "日本\n😀", 10, []string{"日本", "😀"}, []int{0, 7}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines, starts := Lines(wideFont{}, test.text, test.columns*column, 10)
+			if !slices.Equal(lines, test.lines) || !slices.Equal(starts, test.starts) {
+				t.Errorf("Lines(%q) = %q %v, want %q %v", test.text, lines, starts, test.lines, test.starts)
+			}
+			for i, line := range lines {
+				if !utf8.ValidString(line) {
+					t.Errorf("line %q is not valid UTF-8", line)
+				}
+				if measure(wideFont{}, line) > test.columns*column {
+					t.Errorf("line %q wider than %d columns", line, test.columns)
+				}
+				if !utf8.ValidString(test.text[starts[i]:]) {
+					t.Errorf("line %d starts inside of a rune", i)
+				}
+			}
+		})
+	}
+}
+
+func TestTruncateMultibyte(t *testing.T) {
+	tests := []struct {
+		line      string
+		columns   int
+		truncated string
+	}{
+		{"aéb", 5, "aé..."},
+		{"ééé", 5, "éé..."},
+		{"日本語", 6, "日..."},
+		{"日本語", 7, "日本..."},
+		{"😀😀", 4, "..."},
+		{"😀😀", 5, "😀..."},
+		{"ž日", 5, "ž..."},
+	}
+	for _, test := range tests {
+		truncated := Truncate(wideFont{}, test.line, test.columns*column)
+		if truncated != test.truncated {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", test.line, test.columns, truncated, test.truncated)
+		}
+		if !utf8.ValidString(truncated) {
+			t.Errorf("Truncate(%q, %d) = %q is not valid UTF-8", test.line, test.columns, truncated)
+		}
+	}
+}
@@ -5,67 +5,76 @@ package main
 import (
 	"image/color"
 	"machine"
-	"strings"
+	"strconv"
 	"time"
 
 	"tinygo.org/x/drivers/st7789"
 	"tinygo.org/x/drivers/ws2812"
 	"tinygo.org/x/tinyfont"
-	"tinygo.org/x/tinyfont/freemono"
 
+	"github.com/coltwillcox/ngn/gopherbadge/screens"
+	"github.com/coltwillcox/ngn/gopherbadge/storage"
+	"github.com/coltwillcox/ngn/gopherbadge/theme"
 	"github.com/coltwillcox/ngn/gopherbadge/views"
+	"github.com/coltwillcox/ngn/protocol"
 )
 
-type Notification struct {
-	Program   string
-	Title     string
-	Body      string
-	Sender    string
-	Serial    string
-	CreatedAt string
-	Icon      string
-}
+// Notification is shared with daemon, together with its decoder.
+type Notification = protocol.Notification
+
+// Screens of the carousel, Up switches to the next one and Down to the previous one.
+const (
+	screenHistory = iota
+	screenClock
+	screenPlaying
+	screenStats
+	screenPomodoro
+)
 
 const (
-	carriageReturn        = 10  // Character code for a new line.
-	newLine               = 13  // Character code for a new line.
-	timeRest              = 10  // Milliseconds.
-	timeDimmer            = 100 // Milliseconds.
-	maximumRects   int    = 10
-	historySize    int    = 10
-	footerX        int16  = 0
-	footerY        int16  = 217
-	pageRectWidth  int16  = 8
-	pageRectHeight int16  = 16
-	pageRectSpace  int16  = 6
-	screenWidth    int16  = 320
-	screenHeight   int16  = 240
-	textViewHeight int16  = 30
-	margin         int16  = 8
-	commandClear   string = "clear"
-	separator      rune   = '*'
+	timeRest               = 10         // Milliseconds.
+	timeDimmer             = 100        // Milliseconds.
+	timePersist            = 5          // Seconds. History is saved after it stays unchanged this long, so bursts are written once.
+	timeRead               = 2          // Seconds. Page viewed this long is marked as read.
+	timeIdle               = 120        // Seconds. Clock is shown after nobody touches the badge this long.
+	timeIdleEmpty          = 5          // Seconds. Same for empty history.
+	slotSize               = 128 * 1024 // Bytes of flash for one saved history.
+	maximumHistory  int    = 100        // Entries. Reported to daemon, which can set lower depth.
+	defaultHistory  int    = 50
+	historyBudget   int    = 96 * 1024 // Bytes of text, icons and bitmaps kept in history.
+	footerRects     int    = 10        // Pages shown in footer at once, footer is paginated by them.
+	footerX         int16  = 0
+	footerY         int16  = 217
+	pageRectWidth   int16  = 8
+	pageRectHeight  int16  = 16
+	pageRectSpace   int16  = 6
+	unreadViewWidth int16  = 32
+	hintX           int16  = footerX + theme.Margin + 225
+	pagesWidth      int16  = int16(footerRects)*(pageRectWidth+pageRectSpace) - pageRectSpace
+	positionX       int16  = footerX + theme.Margin + pagesWidth + pageRectSpace // Current page number and count.
+	scrollBarY      int16  = footerY + pageRectHeight + 2
+	scrollBarHeight int16  = 2
+	blankStrip      string = "0,20," // Empty line between title and body bitmaps.
 )
 
 var (
-	uart                 = machine.Serial // Serial port stream.
-	display              = st7789.New(machine.SPI0, machine.TFT_RST, machine.TFT_WRX, machine.TFT_CS, machine.TFT_BACKLIGHT)
-	leds                 = machine.NEOPIXELS
-	ledsDriver           = ws2812.New(leds)
-	black                = color.RGBA{0, 0, 0, 255}
-	white                = color.RGBA{255, 255, 255, 255}
-	red                  = color.RGBA{255, 0, 0, 255}
-	blue                 = color.RGBA{0, 0, 255, 255}
-	green                = color.RGBA{0, 255, 0, 255}
-	violet               = color.RGBA{116, 58, 213, 255}
-	yellow               = color.RGBA{255, 255, 0, 255}
-	font                 = &freemono.Regular9pt7b // Font used to display the text.
+	uart       = machine.Serial // Serial port stream.
+	display    = st7789.New(machine.SPI0, machine.TFT_RST, machine.TFT_WRX, machine.TFT_CS, machine.TFT_BACKLIGHT)
+	leds       = machine.NEOPIXELS
+	ledsDriver = ws2812.New(leds)
+	// theme.Font has glyphs for printable ASCII only, other text can be rendered by daemon.
+	capabilities         = protocol.Capabilities{Version: protocol.Version, Charset: protocol.CharsetASCII, Bitmap: true, History: maximumHistory}
+	screenList           []screens.Screen // Carousel, in order of Up. Index is one of screen* constants.
+	currentScreen        = screenHistory
 	screenBorderRectView = views.RectView{}
 	programTextView      = views.TextView{}
+	unreadTextView       = views.TextView{}
 	timeTextView         = views.TextView{}
 	messageTextView      = views.TextView{}
 	iconImageView        = views.ImageView{}
-	history              = make([]Notification, 0, historySize)
-	pagesRectViews       = make([]views.RectView, historySize)
+	history              = make([]storage.Entry, 0, defaultHistory)
+	historyDepth         = defaultHistory
+	pagesRectViews       = make([]views.RectView, footerRects)
 	currentPage          = 0
 	buttonA              = machine.BUTTON_A
 	buttonB              = machine.BUTTON_B
@@ -74,46 +83,58 @@ var (
 	buttonDown           = machine.BUTTON_DOWN
 	buttonRight          = machine.BUTTON_RIGHT
 	ledOpacity           = -1
+	ledColor             *color.RGBA // Color requested by notification, nil for default red and blue eyes.
+	hostOnline           = true
+	detailView           = false                          // Shows title and body of current notification, scrolled with Up and Down.
+	moreText             = false                          // Current notification has more text than page shows.
+	store                *storage.Store                   // Nil if flash has no room for history.
+	historyChanged       time.Time                        // Zero if history is saved.
+	viewedSince          time.Time                        // When user started looking at current page, zero if page was not opened by user.
+	pages                = make([]int, 0, defaultHistory) // History indices shown as pages, see updatePages.
+	grouped              = false                          // Pages show programs instead of single notifications.
+	drilled              = false                          // Pages show notifications of drilledProgram, when grouped.
+	drilledProgram       = ""
+	buttonAHeld          = false   // A toggles group, so it must not repeat while held.
+	buttonHeld           = false   // Any button was pressed at previous check, switching screens and widget actions don't repeat.
+	lastActivity         time.Time // Of buttons and notifications, zero after start without history.
+	clockTime            time.Time // Local time of host when daemon synced clock, in UTC location. Zero until synced.
+	clockSyncedAt        time.Time // Badge timer when daemon synced clock.
 )
 
 func main() {
 	configure()
 	drawUI()
+	restoreHistory()
 	drawFooter()
+	if len(history) != 0 {
+		lastActivity = time.Now()
+	}
 
-	channelMessage := make(chan string, 1)
+	channelMessage := make(chan protocol.Message, 1)
+	persistTicker := time.NewTicker(timePersist * time.Second)
 
 	go func() {
 		for {
 			time.Sleep(timeDimmer * time.Millisecond)
 			dimLeds()
 			checkButtons()
+			checkRead()
+			checkScreen()
 		}
 	}()
 
 	go func() {
-		text := make([]byte, 0)
+		decoder := protocol.Decoder{}
 		for {
 			time.Sleep(timeRest * time.Millisecond)
-			if uart.Buffered() == 0 {
-				continue
-			}
-
-			for {
-				singleByte, _ := uart.ReadByte()
-				switch singleByte {
-				case carriageReturn, newLine:
-					continue
-				case byte(separator):
-					channelMessage <- string(text)
-					text = nil
+			for uart.Buffered() > 0 {
+				singleByte, err := uart.ReadByte()
+				if err != nil {
 					break
-				default:
-					text = append(text, singleByte)
 				}
-
-				if uart.Buffered() == 0 {
-					break
+				// Invalid message is dropped by decoder, there is nobody to report it to.
+				if message, ok, _ := decoder.Feed(singleByte); ok {
+					channelMessage <- message
 				}
 			}
 		}
@@ -122,15 +143,45 @@ func main() {
 	for {
 		select {
 		case message := <-channelMessage:
-			switch message {
-			case commandClear:
+			switch message.Command {
+			case protocol.CommandClear:
+				setHostOnline(true)
 				clearHistory()
-			default:
-				addToHistory(fromMessage(message))
+			case protocol.CommandBye:
+				setHostOnline(false)
+			case protocol.CommandHello:
+				setHostOnline(true)
+				uart.Write(protocol.AppendCapabilities(nil, capabilities))
+			case protocol.CommandGroup:
+				setGrouped(message.Argument == protocol.ArgumentOn)
+			case protocol.CommandDepth:
+				if depth, err := strconv.Atoi(message.Argument); err == nil {
+					setHistoryDepth(depth)
+				}
+			case protocol.CommandTime:
+				if unix, offset, ok := protocol.ParseTime(message.Argument); ok {
+					setClock(unix, offset)
+				}
+			case "":
+				setHostOnline(true)
+				if message.Widget.Kind != "" {
+					setWidget(message.Widget)
+					break
+				}
+				if !addToHistory(message.Notification) {
+					// History is full of pinned notifications.
+					break
+				}
+				detailView = false
+				viewedSince = time.Time{}
+				lastActivity = time.Now()
+				showScreen(screenHistory)
 				drawCurrentPage()
 				drawFooter()
-				lightUpLeds()
+				lightUpLeds(message.Notification.Color)
 			}
+		case <-persistTicker.C:
+			persistHistory()
 		}
 	}
 }
@@ -152,86 +203,439 @@ func configure() {
 
 	display.Configure(st7789.Config{
 		Rotation: st7789.ROTATION_270,
-		Height:   screenWidth,
-		Width:    screenHeight,
+		Height:   theme.ScreenWidth,
+		Width:    theme.ScreenHeight,
 	})
 
 	for i := 0; i < len(pagesRectViews); i++ {
-		pagesRectViews[i].SetDisplay(&display).SetDimensions(footerX+margin+(int16(i)*(pageRectWidth+pageRectSpace)), footerY, pageRectWidth, pageRectHeight).SetColor(&violet)
+		pagesRectViews[i].SetDisplay(&display).SetDimensions(footerX+theme.Margin+(int16(i)*(pageRectWidth+pageRectSpace)), footerY, pageRectWidth, pageRectHeight).SetColor(&theme.Violet)
+	}
+
+	screenList = []screens.Screen{
+		screenHistory:  historyScreen{},
+		screenClock:    screens.NewClock(&display, clock, clockStatus),
+		screenPlaying:  screens.NewPlaying(&display),
+		screenStats:    screens.NewStats(&display),
+		screenPomodoro: screens.NewPomodoro(&display),
+	}
+	for _, screen := range screenList {
+		if widget, ok := screen.(screens.Widget); ok {
+			capabilities.Widgets = append(capabilities.Widgets, widget.Kind())
+		}
 	}
 }
 
 func drawUI() {
-	screenBorderRectView.SetDisplay(&display).SetColor(&violet).SetDimensions(0, 0, screenWidth, screenHeight).Draw()
-	programTextView.SetDisplay(&display).SetFont(font).SetFontColor(&yellow).SetColor(&violet).SetDimensions(margin, margin, screenWidth-margin*2-40, textViewHeight).Draw()
-	timeTextView.SetDisplay(&display).SetFont(font).SetFontColor(&yellow).SetColor(&violet).SetDimensions(margin, textViewHeight+margin*2-1, screenWidth-margin*2, textViewHeight).Draw()
-	messageTextView.SetDisplay(&display).SetFont(font).SetFontColor(&yellow).SetColor(&violet).SetDimensions(margin, textViewHeight*2+margin*3-2, 304, 126).Draw()
-	iconImageView.SetDisplay(&display).SetBackgroundColor(&black).SetDimensions(281, margin, textViewHeight, textViewHeight).Draw()
+	screenBorderRectView.SetDisplay(&display).SetColor(&theme.Violet).SetDimensions(0, 0, theme.ScreenWidth, theme.ScreenHeight).Draw()
+	programTextView.SetDisplay(&display).SetFont(theme.Font).SetFontColor(&theme.Yellow).SetColor(&theme.Violet).SetDimensions(theme.Margin, theme.Margin, theme.ScreenWidth-theme.Margin*3-40-unreadViewWidth, theme.LineHeight).Draw()
+	unreadTextView.SetDisplay(&display).SetFont(theme.Font).SetFontColor(&theme.White).SetColor(&theme.Violet).SetDimensions(theme.ScreenWidth-theme.Margin-40-unreadViewWidth, theme.Margin, unreadViewWidth, theme.LineHeight).Draw()
+	timeTextView.SetDisplay(&display).SetFont(theme.Font).SetFontColor(&theme.Yellow).SetColor(&theme.Violet).SetDimensions(theme.Margin, theme.LineHeight+theme.Margin*2-1, theme.ScreenWidth-theme.Margin*2, theme.LineHeight).Draw()
+	messageTextView.SetDisplay(&display).SetFont(theme.Font).SetFontColor(&theme.Yellow).SetEmphasisColor(&theme.White).SetColor(&theme.Violet).SetDimensions(theme.Margin, theme.LineHeight*2+theme.Margin*3-2, 304, 126).Draw()
+	iconImageView.SetDisplay(&display).SetBackgroundColor(&theme.Black).SetDimensions(281, theme.Margin, theme.LineHeight, theme.LineHeight).Draw()
 }
 
 func drawFooter() {
-	for i := 0; i < historySize; i++ {
-		color := violet
-		backgroundColor := black
-		if i == currentPage {
-			color = yellow
+	if currentScreen != screenHistory {
+		return
+	}
+	// Footer shows footerRects pages around current one, with position among all pages.
+	first := currentPage / footerRects * footerRects
+	for i := 0; i < footerRects; i++ {
+		page := first + i
+		color := theme.Violet
+		backgroundColor := theme.Black
+		exists, unread, pinned := pageState(page)
+		if page == currentPage {
+			color = theme.Yellow
+		} else if pinned {
+			color = theme.Red
 		}
-		if len(history) > i {
-			backgroundColor = violet
+		if exists {
+			backgroundColor = theme.Violet
+			if unread {
+				backgroundColor = theme.Yellow
+			}
 		}
 		pagesRectViews[i].SetColor(&color).SetBackgroundColor(&backgroundColor).Draw()
 	}
-	tinyfont.WriteLine(&display, font, footerX+margin+225, footerY+13, "L/R/A/B", violet)
-}
-
-func fromMessage(message string) Notification {
-	notification := Notification{}
-	messageTrimmed := strings.TrimSuffix(strings.TrimPrefix(message, "{\""), "\"}")
-	parts := strings.Split(messageTrimmed, "\",\"")
-	for _, part := range parts {
-		keyValue := strings.Split(part, "\":\"")
-		switch keyValue[0] {
-		case "program":
-			notification.Program = keyValue[1]
-		case "title":
-			notification.Title = keyValue[1]
-		case "body":
-			notification.Body = keyValue[1]
-		case "sender":
-			notification.Sender = keyValue[1]
-		case "serial":
-			notification.Serial = keyValue[1]
-		case "created_at":
-			notification.CreatedAt = keyValue[1]
-		case "icon":
-			notification.Icon = keyValue[1]
+	drawPagesPosition(first)
+	unread := ""
+	if count := unreadCount(); count != 0 {
+		unread = strconv.Itoa(count)
+	}
+	unreadTextView.SetText(unread)
+	display.FillRectangle(hintX, footerY, theme.ScreenWidth-hintX-theme.Margin, pageRectHeight, theme.Black)
+	switch {
+	case !hostOnline:
+		tinyfont.WriteLine(&display, theme.Font, hintX, footerY+13, "OFFLINE", theme.Red)
+	case detailView:
+		tinyfont.WriteLine(&display, theme.Font, hintX, footerY+13, "U/D", theme.Violet)
+	case moreText:
+		tinyfont.WriteLine(&display, theme.Font, hintX, footerY+13, "MORE v", theme.Yellow)
+	case grouped && !drilled:
+		tinyfont.WriteLine(&display, theme.Font, hintX, footerY+13, "A OPEN", theme.Violet)
+	case drilled:
+		tinyfont.WriteLine(&display, theme.Font, hintX, footerY+13, "A BACK", theme.Violet)
+	default:
+		tinyfont.WriteLine(&display, theme.Font, hintX, footerY+13, "L/R/A/B", theme.Violet)
+	}
+}
+
+// drawPagesPosition shows current page number and count of pages, and scroll bar if they don't fit in footer.
+func drawPagesPosition(first int) {
+	display.FillRectangle(positionX, footerY, hintX-positionX, pageRectHeight, theme.Black)
+	if len(pages) != 0 {
+		position := strconv.Itoa(currentPage+1) + "/" + strconv.Itoa(len(pages))
+		tinyfont.WriteLine(&display, theme.Font, positionX, footerY+13, position, theme.Violet)
+	}
+
+	trackX := footerX + theme.Margin
+	display.FillRectangle(trackX, scrollBarY, pagesWidth, scrollBarHeight, theme.Black)
+	if len(pages) > footerRects {
+		thumbX := int(pagesWidth) * first / len(pages)
+		thumbWidth := max(int(pagesWidth)*footerRects/len(pages), 1)
+		display.FillRectangle(trackX+int16(thumbX), scrollBarY, int16(min(thumbWidth, int(pagesWidth)-thumbX)), scrollBarHeight, theme.Violet)
+	}
+}
+
+// setHostOnline shows in footer whether daemon is running on host.
+func setHostOnline(online bool) {
+	if hostOnline == online {
+		return
+	}
+	hostOnline = online
+	drawFooter()
+}
+
+// addToHistory puts pinned notification after other pinned ones, and normal one at the end.
+// Full history evicts the oldest normal notification. Pinned ones are evicted only by pinned ones,
+// normal notification is dropped (returns false) if all are pinned. Dropped and evicted notifications are
+// reported as read, so daemon doesn't keep them unread.
+func addToHistory(notification Notification) bool {
+	pinned := pinnedCount()
+	if len(history) >= historyDepth && pinned == len(history) && !notification.Pinned() {
+		reportRead(storage.Entry{Notification: notification})
+		return false
+	}
+
+	index := len(history)
+	if notification.Pinned() {
+		index = pinned
+	}
+	history = append(history, storage.Entry{})
+	copy(history[index+1:], history[index:])
+	history[index] = storage.Entry{Notification: notification}
+	index = trimHistory(index)
+	drilled = false
+	updatePages()
+	currentPage = pageOf(index)
+	historyChanged = time.Now()
+	return true
+}
+
+// trimHistory keeps history within historyDepth entries and historyBudget bytes, never touching entry keep.
+// Over budget, icons and bitmaps of the oldest notifications are dropped first, their text is still shown.
+// Returns index of keep after eviction.
+func trimHistory(keep int) int {
+	ok := true
+	for ok && len(history) > historyDepth {
+		keep, ok = evict(keep)
+	}
+	for ok && historyBytes() > historyBudget {
+		if !strip(keep) {
+			keep, ok = evict(keep)
+		}
+	}
+	return keep
+}
+
+// evict removes the oldest normal notification other than keep, or the oldest pinned one if keep is pinned too
+// (or there is no keep, -1). Evicted notification is reported as read. Returns index of keep after eviction, and false if nothing could be evicted.
+func evict(keep int) (int, bool) {
+	candidate := -1
+	for i, entry := range history {
+		if i != keep && !entry.Notification.Pinned() {
+			candidate = i
+			break
 		}
 	}
+	if candidate < 0 && (keep < 0 || history[keep].Notification.Pinned()) {
+		for i := range history {
+			if i != keep {
+				candidate = i
+				break
+			}
+		}
+	}
+	if candidate < 0 {
+		return keep, false
+	}
+
+	reportRead(history[candidate])
+	history = append(history[:candidate], history[candidate+1:]...)
+	if candidate < keep {
+		keep--
+	}
+	return keep, true
+}
+
+// strip drops icon and bitmaps of the oldest notification other than keep which has any.
+func strip(keep int) bool {
+	for i := range history {
+		n := &history[i].Notification
+		if i != keep && (n.Icon != "" || n.TitleBitmap != "" || n.BodyBitmap != "") {
+			n.Icon, n.TitleBitmap, n.BodyBitmap = "", "", ""
+			return true
+		}
+	}
+	return false
+}
+
+func historyBytes() int {
+	size := 0
+	for _, entry := range history {
+		size += entrySize(entry.Notification)
+	}
+	return size
+}
+
+// entrySize approximates memory taken by notification.
+func entrySize(n Notification) int {
+	return len(n.ID) + len(n.Program) + len(n.Title) + len(n.Body) + len(n.Sender) + len(n.Serial) + len(n.CreatedAt) +
+		len(n.Icon) + len(n.Urgency) + len(n.Sticky) + len(n.Color) + len(n.Links) + len(n.Emphasis) +
+		len(n.TitleBitmap) + len(n.BodyBitmap)
+}
 
-	return notification
+// setHistoryDepth changes number of notifications kept, evicting the oldest ones if there are more.
+func setHistoryDepth(depth int) {
+	depth = min(max(depth, 1), maximumHistory)
+	if historyDepth == depth {
+		return
+	}
+	historyDepth = depth
+	trimHistory(-1)
+	updatePages()
+	currentPage = min(currentPage, max(len(pages)-1, 0))
+	historyChanged = time.Now()
+	drawCurrentPage()
+	drawFooter()
+	shutDownLeds()
 }
 
-func addToHistory(notification Notification) {
-	if len(history) >= historySize {
-		history = history[1:]
+// pinnedCount returns number of pinned notifications, which are always at the start of history.
+func pinnedCount() int {
+	count := 0
+	for count < len(history) && history[count].Notification.Pinned() {
+		count++
 	}
-	history = append(history, notification)
-	currentPage = len(history) - 1
+	return count
+}
+
+// restoreHistory shows history saved in flash before reset, and flashes eyes if there is any.
+func restoreHistory() {
+	var err error
+	if store, err = storage.New(machine.Flash, slotSize); err != nil {
+		store = nil
+		return
+	}
+	snapshot, err := store.Load()
+	if err != nil {
+		return
+	}
+
+	if snapshot.Settings.Depth > 0 {
+		historyDepth = min(snapshot.Settings.Depth, maximumHistory)
+	}
+	// Pinned notifications first, history saved by older firmware is not sorted.
+	history = history[:0]
+	for _, entry := range snapshot.History {
+		if entry.Notification.Pinned() {
+			history = append(history, entry)
+		}
+	}
+	for _, entry := range snapshot.History {
+		if !entry.Notification.Pinned() {
+			history = append(history, entry)
+		}
+	}
+	trimHistory(-1)
+	grouped = snapshot.Settings.Grouped
+	updatePages()
+	currentPage = min(max(snapshot.Settings.Page, 0), max(len(pages)-1, 0))
+	drawCurrentPage()
+	for i := len(history) - 1; i >= 0; i-- {
+		if !history[i].Read {
+			lightUpLeds(history[i].Notification.Color)
+			break
+		}
+	}
+}
+
+// persistHistory saves history to flash, once it stops changing.
+// Flash writes stall the whole badge for a moment, and wear flash out, so they are kept rare.
+func persistHistory() {
+	if store == nil || historyChanged.IsZero() || time.Since(historyChanged) < timePersist*time.Second {
+		return
+	}
+	historyChanged = time.Time{}
+	// Failed write leaves the previous history in flash, there is nobody to report it to.
+	store.Save(storage.Snapshot{Settings: storage.Settings{Page: currentPage, Grouped: grouped, Depth: historyDepth}, History: history})
 }
 
 func removeFromHistory(i int) bool {
-	if len(history) == 0 || len(history) <= i {
+	if i < 0 || len(history) <= i {
 		return false
 	}
 
+	// Deleted notification counts as read.
+	reportRead(history[i])
 	history = append(history[:i], history[i+1:]...)
+	updatePages()
+	historyChanged = time.Now()
 	return true
 }
 
+// removeGroup removes all notifications of program shown on page.
+func removeGroup(page int) bool {
+	entries := pageEntries(page)
+	for i := len(entries) - 1; i >= 0; i-- {
+		removeFromHistory(entries[i])
+	}
+	return len(entries) != 0
+}
+
+// updatePages lists history indices shown as pages: every notification, or the newest one of each program
+// when grouped, or every notification of drilledProgram when group is opened.
+func updatePages() {
+	pages = pages[:0]
+	for i, entry := range history {
+		switch {
+		case !grouped:
+			pages = append(pages, i)
+		case drilled:
+			if entry.Notification.Program == drilledProgram {
+				pages = append(pages, i)
+			}
+		default:
+			if page := programPage(entry.Notification.Program); page >= 0 {
+				pages[page] = i
+			} else {
+				pages = append(pages, i)
+			}
+		}
+	}
+	if drilled && len(pages) == 0 {
+		// The whole group was removed.
+		drilled = false
+		updatePages()
+	}
+}
+
+// programPage returns page of program, or -1 if none of pages shows it.
+func programPage(program string) int {
+	for page, i := range pages {
+		if history[i].Notification.Program == program {
+			return page
+		}
+	}
+	return -1
+}
+
+// pageOf returns page showing history entry i, or its program when pages show programs.
+func pageOf(i int) int {
+	if i < 0 || len(history) <= i {
+		return 0
+	}
+	if grouped && !drilled {
+		return max(programPage(history[i].Notification.Program), 0)
+	}
+	for page, index := range pages {
+		if index == i {
+			return page
+		}
+	}
+	return 0
+}
+
+// currentEntry returns history index shown on current page, or -1 if page is empty.
+func currentEntry() int {
+	if currentPage < 0 || len(pages) <= currentPage {
+		return -1
+	}
+	return pages[currentPage]
+}
+
+// pageEntries returns history indices behind page, all notifications of its program when pages show programs.
+func pageEntries(page int) []int {
+	if page < 0 || len(pages) <= page {
+		return nil
+	}
+	if !grouped || drilled {
+		return pages[page : page+1]
+	}
+	entries := make([]int, 0, len(history))
+	program := history[pages[page]].Notification.Program
+	for i, entry := range history {
+		if entry.Notification.Program == program {
+			entries = append(entries, i)
+		}
+	}
+	return entries
+}
+
+// pageState reports whether page shows anything, and whether any of notifications behind it is unread or pinned.
+func pageState(page int) (exists, unread, pinned bool) {
+	for _, i := range pageEntries(page) {
+		exists = true
+		unread = unread || !history[i].Read
+		pinned = pinned || history[i].Notification.Pinned()
+	}
+	return exists, unread, pinned
+}
+
+// setGrouped switches pages between single notifications and programs, keeping current notification selected.
+func setGrouped(on bool) {
+	if grouped == on {
+		return
+	}
+	i := currentEntry()
+	grouped, drilled, detailView = on, false, false
+	updatePages()
+	if i >= 0 {
+		currentPage = pageOf(i)
+	}
+	historyChanged = time.Now()
+	drawCurrentPage()
+	drawFooter()
+}
+
+// openGroup shows notifications of current program as pages, or goes back to programs.
+func openGroup(open bool) {
+	i := currentEntry()
+	if open && i < 0 {
+		return
+	}
+	drilled, detailView = open, false
+	if open {
+		drilledProgram = history[i].Notification.Program
+	}
+	updatePages()
+	currentPage = pageOf(i)
+	viewedSince = time.Now()
+	drawCurrentPage()
+	drawFooter()
+}
+
 func clearHistory() {
 	if len(history) != 0 {
-		history = make([]Notification, 0, historySize)
+		for _, entry := range history {
+			reportRead(entry)
+		}
+		history = make([]storage.Entry, 0, defaultHistory)
+		drilled = false
+		updatePages()
 		currentPage = 0
+		historyChanged = time.Now()
 		drawCurrentPage()
 		drawFooter()
 	}
@@ -264,35 +668,170 @@ func chunks(text string, chunkSize int, maximumChunks int) []string {
 }
 
 func drawCurrentPage() {
-	if len(history)-1 < currentPage || len(history) == 0 {
+	if currentScreen != screenHistory {
+		return
+	}
+	// Screen frame tells pinned notification apart.
+	frameColor := theme.Violet
+	if _, _, pinned := pageState(currentPage); pinned {
+		frameColor = theme.Red
+	}
+	screenBorderRectView.SetColor(&frameColor).DrawBorder()
+
+	index := currentEntry()
+	if index < 0 {
+		detailView, moreText = false, false
 		programTextView.SetText("")
 		timeTextView.SetText("")
-		messageTextView.SetText("")
+		messageTextView.Set("", "", nil, false)
 		iconImageView.SetImage("")
 		return
 	}
 
-	currentNotification := history[currentPage]
-	programTextView.SetText(currentNotification.Program)
-	timeTextView.SetText(currentNotification.CreatedAt)
-	messageTextView.SetText(currentNotification.Title)
+	currentNotification := history[index].Notification
+	program := currentNotification.Program
+	if count := len(pageEntries(currentPage)); count > 1 {
+		program += " (" + strconv.Itoa(count) + ")"
+	}
+	programTextView.SetText(program)
 	iconImageView.SetImage(currentNotification.Icon)
+	if detailView {
+		drawDetail(currentNotification)
+		return
+	}
+
+	timeTextView.SetText(relativeTime(currentNotification.CreatedAt))
+	messageTextView.Set(currentNotification.Title, currentNotification.TitleBitmap, nil, false)
+	moreText = messageTextView.Truncated() || currentNotification.Body != ""
+}
+
+// drawDetail shows sender, title and body of notification, with body emphasis.
+func drawDetail(notification Notification) {
+	sender := notification.Sender
+	if notification.Serial != "" {
+		sender += " #" + notification.Serial
+	}
+	timeTextView.SetText(sender)
+
+	text := notification.Title
+	emphasisOffset := 0
+	if notification.Body != "" {
+		text += "\n\n" + notification.Body
+		emphasisOffset = len(notification.Title) + 2
+	}
+
+	bitmap := notification.TitleBitmap
+	if notification.BodyBitmap != "" {
+		if bitmap != "" {
+			bitmap += ";" + blankStrip + ";"
+		}
+		bitmap += notification.BodyBitmap
+	}
+
+	messageTextView.Set(text, bitmap, views.ParseSpans(notification.Emphasis, emphasisOffset), true)
 }
 
 func checkButtons() {
+	pressed := !buttonLeft.Get() || !buttonRight.Get() || !buttonDown.Get() || !buttonUp.Get() || !buttonB.Get() || !buttonA.Get()
+	if pressed {
+		lastActivity = time.Now()
+	}
+	repeated := buttonHeld
+	buttonHeld = pressed
+	if currentScreen != screenHistory {
+		if !repeated {
+			checkScreenButtons()
+		}
+		buttonAHeld = !buttonA.Get()
+		return
+	}
+
 	if !buttonLeft.Get() {
 		navigatePage(false)
 	} else if !buttonRight.Get() {
 		navigatePage(true)
+	} else if !buttonDown.Get() {
+		if detailView {
+			messageTextView.Scroll(1)
+		} else if currentEntry() >= 0 {
+			setDetailView(true)
+		} else if !repeated {
+			switchScreen(-1)
+		}
+	} else if !buttonUp.Get() {
+		// Scrolling above the first line goes back to page, Up on page goes to the next screen.
+		if detailView {
+			if !messageTextView.Scroll(-1) {
+				setDetailView(false)
+			}
+		} else if !repeated {
+			switchScreen(1)
+		}
 	} else if !buttonB.Get() {
-		if removeFromHistory(currentPage) {
+		var removed bool
+		if grouped && !drilled {
+			removed = removeGroup(currentPage)
+		} else {
+			removed = removeFromHistory(currentEntry())
+		}
+		if removed {
+			viewedSince = time.Now()
 			drawCurrentPage()
 			drawFooter()
 		}
 		shutDownLeds()
 	} else if !buttonA.Get() {
-		clearHistory()
+		if !grouped {
+			clearHistory()
+		} else if !buttonAHeld {
+			openGroup(!drilled)
+		}
+	}
+	buttonAHeld = !buttonA.Get()
+}
+
+// checkScreenButtons handles buttons of screens other than history. Up and Down switch screens,
+// widget reports other buttons to daemon, and clock goes back to history.
+func checkScreenButtons() {
+	if !buttonUp.Get() {
+		switchScreen(1)
+		return
+	}
+	if !buttonDown.Get() {
+		switchScreen(-1)
+		return
 	}
+
+	action := ""
+	switch {
+	case !buttonA.Get():
+		action = protocol.ActionToggle
+	case !buttonB.Get():
+		action = protocol.ActionStop
+	case !buttonLeft.Get():
+		action = protocol.ActionPrevious
+	case !buttonRight.Get():
+		action = protocol.ActionNext
+	default:
+		return
+	}
+	widget, ok := screenList[currentScreen].(screens.Widget)
+	if !ok {
+		// Press only wakes history, so nothing is removed by accident.
+		showScreen(screenHistory)
+		return
+	}
+	uart.Write(protocol.AppendAction(nil, widget.Kind(), action))
+}
+
+func setDetailView(detail bool) {
+	if detailView == detail {
+		return
+	}
+	detailView = detail
+	viewedSince = time.Now()
+	drawCurrentPage()
+	drawFooter()
 }
 
 func navigatePage(advance bool) {
@@ -303,28 +842,193 @@ func navigatePage(advance bool) {
 	currentPage += move
 	if currentPage < 0 {
 		currentPage = 0
-	} else if currentPage > historySize-1 {
-		currentPage = historySize - 1
+	} else if currentPage > len(pages)-1 {
+		currentPage = max(len(pages)-1, 0)
 	}
+	historyChanged = time.Now()
+	viewedSince = time.Now()
 	drawCurrentPage()
 	drawFooter()
 }
 
+// checkRead marks current page as read, once user has been looking at it for a moment.
+func checkRead() {
+	if viewedSince.IsZero() || time.Since(viewedSince) < timeRead*time.Second {
+		return
+	}
+	viewedSince = time.Time{}
+	index := currentEntry()
+	if index < 0 || history[index].Read {
+		return
+	}
+
+	reportRead(history[index])
+	history[index].Read = true
+	historyChanged = time.Now()
+	drawFooter()
+	shutDownLeds()
+}
+
+// setClock sets clock to local time of host, the badge keeps it with its own timer until the next sync.
+func setClock(unix int64, offset int) {
+	clockTime = time.Unix(unix+int64(offset), 0).UTC()
+	clockSyncedAt = time.Now()
+}
+
+// clock returns local time of host, and false if daemon did not sync clock yet.
+func clock() (time.Time, bool) {
+	if clockTime.IsZero() {
+		return time.Time{}, false
+	}
+	return clockTime.Add(time.Since(clockSyncedAt)), true
+}
+
+// relativeTime formats CreatedAt relative to clock, e.g. "5 min ago".
+// It is returned as it is without clock, and for notifications older than a day.
+func relativeTime(createdAt string) string {
+	now, ok := clock()
+	if !ok {
+		return createdAt
+	}
+	// Both are local time of host in UTC location, so they can be compared.
+	created, err := time.Parse(protocol.TimeFormat, createdAt)
+	if err != nil {
+		return createdAt
+	}
+	switch age := now.Sub(created); {
+	case age < time.Minute:
+		// Clock drift can put fresh notifications slightly in the future.
+		return "just now"
+	case age < time.Hour:
+		return strconv.Itoa(int(age/time.Minute)) + " min ago"
+	case age < 24*time.Hour:
+		return strconv.Itoa(int(age/time.Hour)) + " h ago"
+	}
+	return createdAt
+}
+
+// checkScreen shows clock when nobody touched the badge for a while, and updates current screen.
+func checkScreen() {
+	idle := timeIdle * time.Second
+	if len(history) == 0 {
+		idle = timeIdleEmpty * time.Second
+	}
+	if currentScreen == screenHistory && time.Since(lastActivity) >= idle {
+		showScreen(screenClock)
+	}
+	screenList[currentScreen].Update()
+}
+
+// switchScreen moves through carousel by step, wrapping around.
+func switchScreen(step int) {
+	showScreen((currentScreen + step + len(screenList)) % len(screenList))
+}
+
+// showScreen draws the whole screen, if it is not already shown.
+func showScreen(screen int) {
+	if currentScreen == screen {
+		return
+	}
+	if currentScreen == screenHistory {
+		// Page left for another screen was not really read.
+		viewedSince = time.Time{}
+	}
+	currentScreen = screen
+	screenList[screen].Draw()
+}
+
+// setWidget passes widget data to its screen, and flashes eyes if widget asks for it.
+func setWidget(widget protocol.Widget) {
+	for _, screen := range screenList {
+		if w, ok := screen.(screens.Widget); ok && w.Kind() == widget.Kind {
+			if w.Set(widget) {
+				lightUpLeds("")
+			}
+			return
+		}
+	}
+}
+
+// clockStatus is shown under clock: offline host, or unread count.
+func clockStatus() string {
+	if !hostOnline {
+		return "OFFLINE"
+	}
+	if count := unreadCount(); count != 0 {
+		return strconv.Itoa(count) + " unread"
+	}
+	return ""
+}
+
+// historyScreen shows notification history, drawn by functions above.
+type historyScreen struct{}
+
+func (historyScreen) Draw() {
+	drawUI()
+	drawCurrentPage()
+	drawFooter()
+}
+
+// Update keeps relative time of current notification current.
+func (historyScreen) Update() {
+	if index := currentEntry(); index >= 0 && !detailView {
+		timeTextView.SetText(relativeTime(history[index].Notification.CreatedAt))
+	}
+}
+
+// reportRead tells daemon that unread entry was read. Notifications sent without daemon have no ID.
+func reportRead(entry storage.Entry) {
+	if !entry.Read && entry.Notification.ID != "" {
+		uart.Write(protocol.AppendRead(nil, entry.Notification.ID))
+	}
+}
+
+func unreadCount() int {
+	count := 0
+	for _, entry := range history {
+		if !entry.Read {
+			count++
+		}
+	}
+	return count
+}
+
 func dimLeds() {
 	if ledOpacity <= 0 {
 		return
 	}
 
-	ledsDriver.WriteColors([]color.RGBA{color.RGBA{uint8(ledOpacity), 0, 0, 255}, color.RGBA{0, 0, uint8(ledOpacity), 255}})
+	if ledColor != nil {
+		dimmed := color.RGBA{
+			R: uint8(int(ledColor.R) * ledOpacity / 255),
+			G: uint8(int(ledColor.G) * ledOpacity / 255),
+			B: uint8(int(ledColor.B) * ledOpacity / 255),
+			A: 255,
+		}
+		ledsDriver.WriteColors([]color.RGBA{dimmed, dimmed})
+	} else {
+		ledsDriver.WriteColors([]color.RGBA{color.RGBA{uint8(ledOpacity), 0, 0, 255}, color.RGBA{0, 0, uint8(ledOpacity), 255}})
+	}
 	ledOpacity -= 10
 }
 
-func lightUpLeds() {
+// lightUpLeds flashes eyes, in color given as hex RGB or in default colors if empty.
+func lightUpLeds(hexColor string) {
+	ledColor = nil
+	if values, err := strconv.ParseUint(hexColor, 16, 32); err == nil && len(hexColor) == 6 {
+		ledColor = &color.RGBA{
+			R: uint8(values >> 16),
+			G: uint8((values >> 8) & 0xFF),
+			B: uint8(values & 0xFF),
+			A: 255,
+		}
+	}
 	ledOpacity = 255
 }
 
+// shutDownLeds turns eyes off, unless there are unread notifications.
 func shutDownLeds() {
-	if len(history) != 0 {
+	if unreadCount() != 0 {
 		return
 	}
 
@@ -0,0 +1,47 @@
+package screens
+
+import (
+	"time"
+
+	"tinygo.org/x/drivers/st7789"
+
+	"github.com/coltwillcox/ngn/gopherbadge/theme"
+	"github.com/coltwillcox/ngn/gopherbadge/views"
+)
+
+// Clock shows time and date of host, with status line below them (e.g. unread count).
+type Clock struct {
+	frame
+	now    func() (time.Time, bool) // Local time of host, false until daemon syncs clock.
+	status func() string
+	clock  views.TextView
+	date   views.TextView
+	line   views.TextView
+}
+
+func NewClock(display *st7789.Device, now func() (time.Time, bool), status func() string) *Clock {
+	c := &Clock{now: now, status: status}
+	c.frame.configure(display, "", "")
+	c.clock = textView(display, largeFont, &theme.Yellow, 86, 60, 150, 56)
+	c.date = textView(display, theme.Font, &theme.Violet, 68, 130, 184, theme.LineHeight)
+	c.line = textView(display, theme.Font, &theme.White, 68, 165, 184, theme.LineHeight)
+	return c
+}
+
+func (c *Clock) Draw() {
+	c.frame.draw()
+	c.clock.Draw()
+	c.date.Draw()
+	c.line.Draw()
+	c.Update()
+}
+
+func (c *Clock) Update() {
+	clockText, dateText := "--:--", "waiting for host"
+	if now, ok := c.now(); ok {
+		clockText, dateText = now.Format("15:04"), now.Format("Mon 2 Jan 2006")
+	}
+	c.clock.SetText(clockText)
+	c.date.SetText(dateText)
+	c.line.SetText(c.status())
+}
@@ -0,0 +1,76 @@
+package screens
+
+import (
+	"tinygo.org/x/drivers/st7789"
+
+	"github.com/coltwillcox/ngn/gopherbadge/theme"
+	"github.com/coltwillcox/ngn/gopherbadge/views"
+	"github.com/coltwillcox/ngn/protocol"
+)
+
+// Playing shows track played on host, with its album art.
+type Playing struct {
+	frame
+	widget protocol.Widget
+	art    views.ImageView
+	title  views.TextView
+	artist views.TextView
+	album  views.TextView
+	status views.TextView
+}
+
+func NewPlaying(display *st7789.Device) *Playing {
+	p := &Playing{}
+	p.frame.configure(display, "NOW PLAYING", "A PLAY  B STOP  L/R TRACK")
+	p.art.SetDisplay(display).SetBackgroundColor(&theme.Black).SetDimensions(theme.Margin*2, 40, protocol.ArtSize, protocol.ArtSize)
+	p.title = textView(display, theme.Font, &theme.Yellow, 56, 36, 256, 56)
+	p.artist = textView(display, theme.Font, &theme.White, 56, 92, 256, theme.LineHeight)
+	p.album = textView(display, theme.Font, &theme.Violet, theme.Margin, 126, 304, theme.LineHeight)
+	p.status = textView(display, theme.Font, &theme.Violet, theme.Margin, 160, 304, theme.LineHeight)
+	return p
+}
+
+func (p *Playing) Kind() string {
+	return protocol.WidgetPlaying
+}
+
+// Set keeps art received before, daemon sends it only once per ArtID.
+func (p *Playing) Set(widget protocol.Widget) bool {
+	if widget.Art == "" && widget.ArtID != "" && widget.ArtID == p.widget.ArtID {
+		widget.Art = p.widget.Art
+	}
+	p.widget = widget
+	return false
+}
+
+func (p *Playing) Draw() {
+	p.frame.draw()
+	p.art.Draw()
+	p.title.Draw()
+	p.artist.Draw()
+	p.album.Draw()
+	p.status.Draw()
+	p.Update()
+}
+
+func (p *Playing) Update() {
+	w := p.widget
+	if w.Status == "" || w.Status == protocol.StatusStopped {
+		w = protocol.Widget{Title: "Nothing playing"}
+	}
+	status := ""
+	switch w.Status {
+	case protocol.StatusRunning:
+		status = "PLAYING"
+	case protocol.StatusPaused:
+		status = "PAUSED"
+	}
+	if status != "" && w.Player != "" {
+		status += "  " + w.Player
+	}
+	p.art.SetImage(w.Art)
+	p.title.SetText(w.Title)
+	p.artist.SetText(w.Artist)
+	p.album.SetText(w.Album)
+	p.status.SetText(status)
+}
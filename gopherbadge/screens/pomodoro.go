@@ -0,0 +1,88 @@
+package screens
+
+import (
+	"strconv"
+	"time"
+
+	"tinygo.org/x/drivers/st7789"
+
+	"github.com/coltwillcox/ngn/gopherbadge/theme"
+	"github.com/coltwillcox/ngn/gopherbadge/views"
+	"github.com/coltwillcox/ngn/protocol"
+)
+
+// Pomodoro shows work timer run by daemon. Remaining time is counted down on the badge, daemon sends
+// widget only when phase or status changes.
+type Pomodoro struct {
+	frame
+	widget     protocol.Widget
+	receivedAt time.Time
+	phase      views.TextView
+	timer      views.TextView
+	line       views.TextView
+}
+
+func NewPomodoro(display *st7789.Device) *Pomodoro {
+	p := &Pomodoro{}
+	p.frame.configure(display, "POMODORO", "A START/PAUSE  B STOP  R SKIP")
+	p.phase = textView(display, boldFont, &theme.Violet, 100, 40, 120, 36)
+	p.timer = textView(display, largeFont, &theme.Yellow, 86, 84, 150, 56)
+	p.line = textView(display, theme.Font, &theme.White, 68, 150, 184, theme.LineHeight)
+	return p
+}
+
+func (p *Pomodoro) Kind() string {
+	return protocol.WidgetPomodoro
+}
+
+// Set alerts when running timer moves to another phase.
+func (p *Pomodoro) Set(widget protocol.Widget) bool {
+	alert := p.widget.Kind != "" && widget.Status == protocol.StatusRunning && widget.Phase != p.widget.Phase
+	p.widget, p.receivedAt = widget, time.Now()
+	return alert
+}
+
+func (p *Pomodoro) Draw() {
+	p.frame.draw()
+	p.phase.Draw()
+	p.timer.Draw()
+	p.line.Draw()
+	p.Update()
+}
+
+func (p *Pomodoro) Update() {
+	w := p.widget
+	if w.Kind == "" {
+		p.timer.SetText("--:--")
+		p.line.SetText("waiting for host")
+		return
+	}
+
+	phase := "WORK"
+	phaseColor := &theme.Red
+	if w.Phase == protocol.PhaseBreak {
+		phase, phaseColor = "BREAK", &theme.Green
+	}
+	remaining, _ := strconv.Atoi(w.Remaining)
+	if w.Status == protocol.StatusRunning {
+		remaining = max(remaining-int(time.Since(p.receivedAt)/time.Second), 0)
+	}
+	round, _ := strconv.Atoi(w.Round)
+	line := "round " + strconv.Itoa(round+1)
+	switch w.Status {
+	case protocol.StatusPaused:
+		line += ", PAUSED"
+	case protocol.StatusStopped:
+		line = "press A to start"
+	}
+	p.phase.SetFontColor(phaseColor).SetText(phase)
+	p.timer.SetText(twoDigits(remaining/60) + ":" + twoDigits(remaining%60))
+	p.line.SetText(line)
+}
+
+func twoDigits(value int) string {
+	if value < 10 {
+		return "0" + strconv.Itoa(value)
+	}
+	return strconv.Itoa(value)
+}
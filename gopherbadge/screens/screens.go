@@ -0,0 +1,66 @@
+// Package screens draws full screens of the badge, other than notification history.
+package screens
+
+import (
+	"image/color"
+
+	"tinygo.org/x/drivers/st7789"
+	"tinygo.org/x/tinyfont"
+	"tinygo.org/x/tinyfont/freemono"
+
+	"github.com/coltwillcox/ngn/gopherbadge/theme"
+	"github.com/coltwillcox/ngn/gopherbadge/views"
+	"github.com/coltwillcox/ngn/protocol"
+)
+
+const (
+	hintY int16 = theme.ScreenHeight - theme.Margin - 3
+)
+
+var (
+	boldFont  = &freemono.Bold12pt7b
+	largeFont = &freemono.Bold24pt7b // Clock and timer, 28 pixels per character.
+)
+
+// Screen is a full-screen widget, switched with Up and Down.
+type Screen interface {
+	Draw()   // Draws the whole screen, when it is switched to.
+	Update() // Redraws what changed, called periodically while screen is shown.
+}
+
+// Widget is a screen showing data sent by daemon. Buttons pressed on it are reported back as protocol.Action*.
+type Widget interface {
+	Screen
+	Kind() string // One of protocol.Widget* constants.
+	// Set stores widget data, shown on the next Update. Returns true if user should be alerted,
+	// e.g. when pomodoro phase ends.
+	Set(widget protocol.Widget) bool
+}
+
+// frame is border of screen, with title on top and button hints at the bottom.
+type frame struct {
+	display *st7789.Device
+	border  views.RectView
+	title   string
+	hint    string
+}
+
+func (f *frame) configure(display *st7789.Device, title, hint string) {
+	f.display, f.title, f.hint = display, title, hint
+	f.border.SetDisplay(display).SetColor(&theme.Violet).SetDimensions(0, 0, theme.ScreenWidth, theme.ScreenHeight)
+}
+
+func (f *frame) draw() {
+	f.border.Draw()
+	tinyfont.WriteLine(f.display, theme.Font, theme.Margin*2, theme.Margin*3, f.title, theme.Violet)
+	if f.hint != "" {
+		tinyfont.WriteLine(f.display, theme.Font, theme.Margin*2, hintY, f.hint, theme.Violet)
+	}
+}
+
+// textView returns view without visible border, for text inside of frame.
+func textView(display *st7789.Device, font tinyfont.Fonter, fontColor *color.RGBA, x, y, w, h int16) views.TextView {
+	tv := views.TextView{}
+	tv.SetDisplay(display).SetFont(font).SetFontColor(fontColor).SetColor(&theme.Black).SetDimensions(x, y, w, h)
+	return tv
+}
@@ -0,0 +1,103 @@
+package screens
+
+import (
+	"strconv"
+
+	"tinygo.org/x/drivers/st7789"
+
+	"github.com/coltwillcox/ngn/gopherbadge/theme"
+	"github.com/coltwillcox/ngn/gopherbadge/views"
+	"github.com/coltwillcox/ngn/protocol"
+)
+
+const (
+	barX      int16 = 150
+	barWidth  int16 = 150
+	barHeight int16 = 12
+)
+
+// Stats shows CPU and memory usage of host as bars, with load and uptime.
+type Stats struct {
+	frame
+	widget protocol.Widget
+	lines  [4]views.TextView // CPU, memory, load, uptime.
+	bars   [2]int            // Drawn percents of CPU and memory, -1 before the first draw.
+}
+
+func NewStats(display *st7789.Device) *Stats {
+	s := &Stats{}
+	s.frame.configure(display, "HOST", "")
+	for i := range s.lines {
+		// Load and uptime have no bars.
+		width := theme.ScreenWidth - theme.Margin*2
+		if i < len(s.bars) {
+			width = barX - theme.Margin*2
+		}
+		s.lines[i] = textView(display, boldFont, &theme.Yellow, theme.Margin, 40+int16(i)*42, width, 36)
+	}
+	return s
+}
+
+func (s *Stats) Kind() string {
+	return protocol.WidgetStats
+}
+
+func (s *Stats) Set(widget protocol.Widget) bool {
+	s.widget = widget
+	return false
+}
+
+func (s *Stats) Draw() {
+	s.frame.draw()
+	for i := range s.lines {
+		s.lines[i].Draw()
+	}
+	s.bars = [2]int{-1, -1}
+	s.Update()
+}
+
+func (s *Stats) Update() {
+	w := s.widget
+	if w.Kind == "" {
+		s.lines[0].SetText("waiting")
+		return
+	}
+	s.lines[0].SetText("CPU " + orDash(w.CPU, "%"))
+	s.lines[1].SetText("MEM " + orDash(w.Memory, "%"))
+	s.lines[2].SetText("LOAD " + orDash(w.Load, ""))
+	s.lines[3].SetText("UP " + orDash(w.Uptime, ""))
+	s.drawBar(0, w.CPU)
+	s.drawBar(1, w.Memory)
+}
+
+// drawBar shows percent as bar next to its line, redrawing it only when it changes.
+func (s *Stats) drawBar(i int, value string) {
+	percent, err := strconv.Atoi(value)
+	if err != nil {
+		percent = 0
+	}
+	percent = min(max(percent, 0), 100)
+	if s.bars[i] == percent {
+		return
+	}
+	s.bars[i] = percent
+
+	barColor := theme.Violet
+	if percent >= 90 {
+		barColor = theme.Red
+	}
+	y := 40 + int16(i)*42 + (36-barHeight)/2
+	filled := (barWidth - 2) * int16(percent) / 100
+	s.display.FillRectangle(barX, y, barWidth, barHeight, theme.Violet)
+	s.display.FillRectangle(barX+1, y+1, barWidth-2, barHeight-2, theme.Black)
+	if filled > 0 {
+		s.display.FillRectangle(barX+1, y+1, filled, barHeight-2, barColor)
+	}
+}
+
+func orDash(value, unit string) string {
+	if value == "" {
+		return "-"
+	}
+	return value + unit
+}
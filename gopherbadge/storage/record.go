@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+
+	"github.com/coltwillcox/ngn/protocol"
+)
+
+// Payload of FormatVersion 1:
+//
+//	settings length (1 byte), settings (page, 1 byte; flags, 1 byte, settingGrouped; depth, 1 byte)
+//	records, newest first: flags (1 byte, flagRead), length (4 bytes), notification as sent by daemon
+//
+// Settings added later are appended, older firmware ignores them and newer one uses defaults for missing ones.
+const (
+	settingsLength     = 3
+	settingGrouped     = 1 << 0
+	recordHeaderLength = 5
+	flagRead           = 1 << 0
+)
+
+// encode writes snapshot newest first, so the oldest notifications are the ones left out when slot is full.
+func encode(w *writer, snapshot Snapshot) {
+	settingFlags := uint8(0)
+	if snapshot.Settings.Grouped {
+		settingFlags |= settingGrouped
+	}
+	w.write([]byte{settingsLength, uint8(snapshot.Settings.Page), settingFlags, uint8(snapshot.Settings.Depth)})
+
+	var record []byte
+	recordHeader := make([]byte, recordHeaderLength)
+	for i := len(snapshot.History) - 1; i >= 0; i-- {
+		n := snapshot.History[i].Notification
+		record = protocol.AppendNotification(record[:0], n)
+		if !w.fits(recordHeaderLength + len(record)) {
+			// Text alone is enough to show notification, daemon sends bitmaps and icons again only for new ones.
+			n.TitleBitmap, n.BodyBitmap, n.Icon = "", "", ""
+			record = protocol.AppendNotification(record[:0], n)
+			if !w.fits(recordHeaderLength + len(record)) {
+				continue
+			}
+		}
+		recordHeader[0] = 0
+		if snapshot.History[i].Read {
+			recordHeader[0] |= flagRead
+		}
+		binary.LittleEndian.PutUint32(recordHeader[1:], uint32(len(record)))
+		w.write(recordHeader)
+		w.write(record)
+	}
+}
+
+func decode(r *reader) (Snapshot, error) {
+	snapshot := Snapshot{}
+	length := make([]byte, 1)
+	if err := r.read(length); err != nil {
+		return snapshot, err
+	}
+	settings := make([]byte, length[0])
+	if err := r.read(settings); err != nil {
+		return snapshot, err
+	}
+	if len(settings) >= 1 {
+		snapshot.Settings.Page = int(settings[0])
+	}
+	if len(settings) >= 2 {
+		snapshot.Settings.Grouped = settings[1]&settingGrouped != 0
+	}
+	if len(settings) >= 3 {
+		snapshot.Settings.Depth = int(settings[2])
+	}
+
+	recordHeader := make([]byte, recordHeaderLength)
+	for r.offset < r.end {
+		if err := r.read(recordHeader); err != nil {
+			return snapshot, err
+		}
+		record := make([]byte, binary.LittleEndian.Uint32(recordHeader[1:]))
+		if int64(len(record)) > r.end-r.offset {
+			return snapshot, ErrNotFound
+		}
+		if err := r.read(record); err != nil {
+			return snapshot, err
+		}
+
+		decoder := protocol.Decoder{}
+		decoded := false
+		for _, b := range record {
+			message, ok, err := decoder.Feed(b)
+			if err != nil {
+				return snapshot, err
+			}
+			if ok {
+				snapshot.History = append(snapshot.History, Entry{Notification: message.Notification, Read: recordHeader[0]&flagRead != 0})
+				decoded = true
+				break
+			}
+		}
+		if !decoded {
+			return snapshot, ErrNotFound
+		}
+	}
+
+	// Records are stored newest first.
+	for i, j := 0, len(snapshot.History)-1; i < j; i, j = i+1, j-1 {
+		snapshot.History[i], snapshot.History[j] = snapshot.History[j], snapshot.History[i]
+	}
+	return snapshot, nil
+}
+
+// writer buffers payload into write blocks, computing its length and checksum.
+// Without device it only computes them, to find out whether snapshot changed before erasing anything.
+type writer struct {
+	device BlockDevice
+	offset int64 // Where buffered page goes.
+	limit  int64
+	page   []byte
+	length int64
+	crc    uint32
+	err    error
+}
+
+func (w *writer) fits(n int) bool {
+	return w.length+int64(n) <= w.limit
+}
+
+func (w *writer) write(p []byte) {
+	w.crc = crc32.Update(w.crc, crc32.IEEETable, p)
+	w.length += int64(len(p))
+	if w.device == nil {
+		return
+	}
+	for len(p) > 0 {
+		n := copy(w.page[len(w.page):cap(w.page)], p)
+		w.page = w.page[:len(w.page)+n]
+		p = p[n:]
+		if len(w.page) == cap(w.page) {
+			w.writePage()
+		}
+	}
+}
+
+// flush writes the last, partially filled page, and returns the first error of all writes.
+func (w *writer) flush() error {
+	if w.device != nil && len(w.page) > 0 {
+		for len(w.page) < cap(w.page) {
+			w.page = append(w.page, erased)
+		}
+		w.writePage()
+	}
+	return w.err
+}
+
+func (w *writer) writePage() {
+	if w.err == nil {
+		_, w.err = w.device.WriteAt(w.page, w.offset)
+	}
+	w.offset += int64(len(w.page))
+	w.page = w.page[:0]
+}
+
+// reader reads payload in [offset, end) of device.
+type reader struct {
+	device BlockDevice
+	offset int64
+	end    int64
+}
+
+func (r *reader) read(p []byte) error {
+	if r.offset+int64(len(p)) > r.end {
+		return ErrNotFound
+	}
+	if _, err := r.device.ReadAt(p, r.offset); err != nil {
+		return err
+	}
+	r.offset += int64(len(p))
+	return nil
+}
@@ -0,0 +1,216 @@
+// Package storage keeps notification history and settings in flash, so they survive reset and unplugging.
+//
+// Flash is split into slots, each holding one complete snapshot. Snapshots are written round robin to the
+// next slot, so erasing is spread over the whole region. Header is written after payload, as a commit mark:
+// snapshot interrupted by power loss has no header, and the previous one is loaded instead.
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+
+	"github.com/coltwillcox/ngn/protocol"
+)
+
+const (
+	FormatVersion = 1 // Increased on every incompatible change of snapshot layout.
+	magic         = "NGNS"
+	headerLength  = 20
+	erased        = 0xFF
+)
+
+var (
+	ErrNoSpace  = errors.New("flash region too small")
+	ErrNotFound = errors.New("no valid snapshot")
+)
+
+// BlockDevice is flash region reserved for data, e.g. machine.Flash.
+type BlockDevice interface {
+	ReadAt(p []byte, off int64) (int, error)
+	WriteAt(p []byte, off int64) (int, error)
+	Size() int64
+	WriteBlockSize() int64
+	EraseBlockSize() int64
+	EraseBlocks(start, length int64) error
+}
+
+// Settings are badge preferences and state restored after reset.
+type Settings struct {
+	Page    int  // Current history page.
+	Grouped bool // History is shown grouped by program.
+	Depth   int  // Maximum number of notifications, 0 for default.
+}
+
+// Entry is notification in history, with its state on the badge.
+type Entry struct {
+	Notification protocol.Notification
+	Read         bool
+}
+
+// Snapshot is everything saved at once.
+type Snapshot struct {
+	Settings Settings
+	History  []Entry // Oldest first.
+}
+
+// Store saves snapshots to device, round robin through slots.
+type Store struct {
+	device   BlockDevice
+	slotSize int64
+	slots    int64
+	slot     int64 // Slot of the last valid snapshot, -1 if there is none.
+	sequence uint32
+	checksum uint32 // Of the last valid payload, identical snapshot is not written again.
+	length   uint32
+}
+
+// New splits device into slots of at least slotSize bytes, rounded up to erase block size.
+func New(device BlockDevice, slotSize int64) (*Store, error) {
+	eraseBlockSize := device.EraseBlockSize()
+	if eraseBlockSize <= 0 {
+		return nil, ErrNoSpace
+	}
+	slotSize = (slotSize + eraseBlockSize - 1) / eraseBlockSize * eraseBlockSize
+	slots := device.Size() / slotSize
+	if slots < 2 {
+		// With a single slot, power loss while writing would lose everything.
+		return nil, ErrNoSpace
+	}
+	return &Store{device: device, slotSize: slotSize, slots: slots, slot: -1}, nil
+}
+
+// Load returns the newest snapshot which is not corrupted. Corrupted snapshots are skipped.
+func (s *Store) Load() (Snapshot, error) {
+	headers := make([]header, s.slots)
+	for i := range headers {
+		headers[i] = s.readHeader(int64(i))
+	}
+
+	for {
+		newest := -1
+		for i, h := range headers {
+			if h.valid && (newest < 0 || h.sequence > headers[newest].sequence) {
+				newest = i
+			}
+		}
+		if newest < 0 {
+			return Snapshot{}, ErrNotFound
+		}
+
+		h := headers[newest]
+		if snapshot, err := s.readPayload(int64(newest), h); err == nil {
+			s.slot, s.sequence, s.checksum, s.length = int64(newest), max(s.sequence, h.sequence), h.checksum, h.length
+			return snapshot, nil
+		}
+		headers[newest].valid = false
+		// Sequence keeps growing past corrupted snapshots, so they are never mistaken for the newest.
+		if h.sequence > s.sequence {
+			s.sequence = h.sequence
+		}
+	}
+}
+
+// Save writes snapshot to the next slot. Notifications that don't fit are stored without bitmaps and icon,
+// or dropped if they still don't fit. Snapshot identical to the last one is not written.
+func (s *Store) Save(snapshot Snapshot) error {
+	dryRun := &writer{limit: s.capacity()}
+	encode(dryRun, snapshot)
+	if s.slot >= 0 && dryRun.crc == s.checksum && uint32(dryRun.length) == s.length {
+		return nil
+	}
+
+	slot := (s.slot + 1) % s.slots
+	start := slot * s.slotSize
+	// Only blocks taken by snapshot are erased, the rest of slot is never read.
+	eraseBlockSize := s.device.EraseBlockSize()
+	used := s.device.WriteBlockSize() + dryRun.length
+	if err := s.device.EraseBlocks(start/eraseBlockSize, (used+eraseBlockSize-1)/eraseBlockSize); err != nil {
+		return err
+	}
+
+	w := &writer{
+		device: s.device,
+		offset: start + s.device.WriteBlockSize(),
+		limit:  s.capacity(),
+		page:   make([]byte, 0, s.device.WriteBlockSize()),
+	}
+	encode(w, snapshot)
+	if err := w.flush(); err != nil {
+		return err
+	}
+
+	h := header{sequence: s.sequence + 1, length: uint32(w.length), checksum: w.crc}
+	page := make([]byte, s.device.WriteBlockSize())
+	for i := range page {
+		page[i] = erased
+	}
+	h.put(page)
+	if _, err := s.device.WriteAt(page, start); err != nil {
+		return err
+	}
+
+	s.slot, s.sequence, s.checksum, s.length = slot, h.sequence, h.checksum, h.length
+	return nil
+}
+
+// header starts every slot. Payload follows in the next write block.
+type header struct {
+	valid    bool
+	version  uint8
+	sequence uint32
+	length   uint32
+	checksum uint32
+}
+
+func (h header) put(b []byte) {
+	copy(b, magic)
+	b[4] = FormatVersion
+	b[5] = protocol.Version
+	b[6], b[7] = 0, 0
+	binary.LittleEndian.PutUint32(b[8:], h.sequence)
+	binary.LittleEndian.PutUint32(b[12:], h.length)
+	binary.LittleEndian.PutUint32(b[16:], h.checksum)
+}
+
+func (s *Store) readHeader(slot int64) header {
+	b := make([]byte, headerLength)
+	if _, err := s.device.ReadAt(b, slot*s.slotSize); err != nil {
+		return header{}
+	}
+	h := header{
+		version:  b[4],
+		sequence: binary.LittleEndian.Uint32(b[8:]),
+		length:   binary.LittleEndian.Uint32(b[12:]),
+		checksum: binary.LittleEndian.Uint32(b[16:]),
+	}
+	h.valid = string(b[:4]) == magic && h.version == FormatVersion &&
+		int64(h.length) <= s.capacity()
+	return h
+}
+
+// capacity returns maximum payload length, header takes the whole first write block of slot.
+func (s *Store) capacity() int64 {
+	return s.slotSize - s.device.WriteBlockSize()
+}
+
+// readPayload verifies checksum of the whole payload first, so corrupted snapshot is never partially restored.
+func (s *Store) readPayload(slot int64, h header) (Snapshot, error) {
+	start := slot*s.slotSize + s.device.WriteBlockSize()
+	buffer := make([]byte, s.device.WriteBlockSize())
+	crc := uint32(0)
+	for read := int64(0); read < int64(h.length); {
+		chunk := buffer[:min(int64(len(buffer)), int64(h.length)-read)]
+		if _, err := s.device.ReadAt(chunk, start+read); err != nil {
+			return Snapshot{}, err
+		}
+		crc = crc32.Update(crc, crc32.IEEETable, chunk)
+		read += int64(len(chunk))
+	}
+	if crc != h.checksum {
+		return Snapshot{}, ErrNotFound
+	}
+
+	r := reader{device: s.device, offset: start, end: start + int64(h.length)}
+	return decode(&r)
+}
@@ -0,0 +1,324 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/coltwillcox/ngn/protocol"
+)
+
+const (
+	writeBlockSize = 256
+	eraseBlockSize = 4096
+	testSlotSize   = 2 * eraseBlockSize
+	testSlots      = 4
+)
+
+var errPowerLoss = errors.New("power lost")
+
+// memoryDevice is flash in memory. Like real flash, writing can only clear bits, so erasing is required first.
+type memoryDevice struct {
+	data    []byte
+	writes  int // Successful writes left before power loss, negative for no limit.
+	erasing []int64
+}
+
+func newMemoryDevice() *memoryDevice {
+	d := &memoryDevice{data: make([]byte, testSlots*testSlotSize), writes: -1}
+	for i := range d.data {
+		d.data[i] = erased
+	}
+	return d
+}
+
+func (d *memoryDevice) ReadAt(p []byte, off int64) (int, error) {
+	return copy(p, d.data[off:]), nil
+}
+
+func (d *memoryDevice) WriteAt(p []byte, off int64) (int, error) {
+	if d.writes == 0 {
+		return 0, errPowerLoss
+	}
+	d.writes--
+	for i, b := range p {
+		d.data[off+int64(i)] &= b
+	}
+	return len(p), nil
+}
+
+func (d *memoryDevice) Size() int64           { return int64(len(d.data)) }
+func (d *memoryDevice) WriteBlockSize() int64 { return writeBlockSize }
+func (d *memoryDevice) EraseBlockSize() int64 { return eraseBlockSize }
+
+func (d *memoryDevice) EraseBlocks(start, length int64) error {
+	d.erasing = append(d.erasing, start)
+	for i := start * eraseBlockSize; i < (start+length)*eraseBlockSize; i++ {
+		d.data[i] = erased
+	}
+	return nil
+}
+
+func snapshot(notifications int, page int) Snapshot {
+	s := Snapshot{Settings: Settings{Page: page, Grouped: page%2 == 0, Depth: 50}}
+	for i := 0; i < notifications; i++ {
+		s.History = append(s.History, Entry{
+			Notification: protocol.Notification{ID: strconv.Itoa(i), Program: "test", Title: "Title " + strconv.Itoa(i), Body: "Body*\"\n"},
+			Read:         i%2 == 0,
+		})
+	}
+	return s
+}
+
+func open(t *testing.T, device BlockDevice) *Store {
+	t.Helper()
+	s, err := New(device, testSlotSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func load(t *testing.T, device BlockDevice) Snapshot {
+	t.Helper()
+	loaded, err := open(t, device).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loaded
+}
+
+func TestEmpty(t *testing.T) {
+	if _, err := open(t, newMemoryDevice()).Load(); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Load of erased device = %v, want ErrNotFound", err)
+	}
+}
+
+func TestTooSmall(t *testing.T) {
+	if _, err := New(newMemoryDevice(), testSlots*testSlotSize); !errors.Is(err, ErrNoSpace) {
+		t.Errorf("New with a single slot = %v, want ErrNoSpace", err)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	device := newMemoryDevice()
+	saved := snapshot(5, 2)
+	if err := open(t, device).Save(saved); err != nil {
+		t.Fatal(err)
+	}
+	if loaded := load(t, device); !reflect.DeepEqual(loaded, saved) {
+		t.Errorf("loaded %+v, want %+v", loaded, saved)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	device := newMemoryDevice()
+	s := open(t, device)
+	for i := 0; i < 2*testSlots+1; i++ {
+		device.erasing = nil
+		saved := snapshot(i, i)
+		if err := s.Save(saved); err != nil {
+			t.Fatal(err)
+		}
+		if want := int64(i%testSlots) * testSlotSize / eraseBlockSize; len(device.erasing) != 1 || device.erasing[0] != want {
+			t.Errorf("save %d erased blocks %v, want slot starting at block %d", i, device.erasing, want)
+		}
+		// Store opened after reset continues with the next slot.
+		if loaded := load(t, device); !reflect.DeepEqual(loaded, saved) {
+			t.Fatalf("save %d loaded %+v, want %+v", i, loaded, saved)
+		}
+		s = open(t, device)
+		s.Load()
+	}
+}
+
+func TestUnchangedNotWritten(t *testing.T) {
+	device := newMemoryDevice()
+	s := open(t, device)
+	s.Save(snapshot(3, 1))
+	device.erasing = nil
+	if err := s.Save(snapshot(3, 1)); err != nil || len(device.erasing) != 0 {
+		t.Errorf("identical snapshot saved again: %v, erased %v", err, device.erasing)
+	}
+}
+
+func TestPowerLossBeforeHeader(t *testing.T) {
+	previous := snapshot(3, 1)
+	for writes := 0; ; writes++ {
+		device := newMemoryDevice()
+		s := open(t, device)
+		if err := s.Save(previous); err != nil {
+			t.Fatal(err)
+		}
+
+		// Power is lost after some pages of payload, header is never written.
+		device.writes = writes
+		err := s.Save(snapshot(20, 2))
+		if err == nil {
+			if writes == 0 {
+				t.Fatal("save without any write succeeded")
+			}
+			break
+		}
+		if loaded := load(t, device); !reflect.DeepEqual(loaded, previous) {
+			t.Fatalf("power loss after %d writes loaded %+v, want previous %+v", writes, loaded, previous)
+		}
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	device := newMemoryDevice()
+	s := open(t, device)
+	previous := snapshot(3, 1)
+	s.Save(previous)
+	s.Save(snapshot(4, 2))
+
+	// Bit flip in payload of the newest snapshot, in the second slot.
+	device.data[testSlotSize+writeBlockSize+10] ^= 0x01
+	if loaded := load(t, device); !reflect.DeepEqual(loaded, previous) {
+		t.Errorf("loaded %+v, want previous %+v", loaded, previous)
+	}
+
+	// Corrupted snapshot is never the newest, next save goes after it.
+	s = open(t, device)
+	s.Load()
+	next := snapshot(5, 3)
+	if err := s.Save(next); err != nil {
+		t.Fatal(err)
+	}
+	if loaded := load(t, device); !reflect.DeepEqual(loaded, next) {
+		t.Errorf("loaded %+v, want %+v", loaded, next)
+	}
+}
+
+func TestAllCorrupted(t *testing.T) {
+	device := newMemoryDevice()
+	s := open(t, device)
+	s.Save(snapshot(1, 1))
+	device.data[writeBlockSize] ^= 0x01
+	if _, err := open(t, device).Load(); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Load = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFullSlot(t *testing.T) {
+	device := newMemoryDevice()
+	s := open(t, device)
+	saved := snapshot(200, 1)
+	for i := range saved.History {
+		saved.History[i].Notification.Icon = "ff00ff00ff00ff00ff00"
+	}
+	if err := s.Save(saved); err != nil {
+		t.Fatal(err)
+	}
+	loaded := load(t, device)
+	if len(loaded.History) == 0 || len(loaded.History) >= len(saved.History) {
+		t.Fatalf("loaded %d of %d notifications, want the newest that fit", len(loaded.History), len(saved.History))
+	}
+	// The oldest notifications are left out.
+	newest := saved.History[len(saved.History)-1]
+	if last := loaded.History[len(loaded.History)-1]; last != newest {
+		t.Errorf("newest loaded %+v, want %+v", last, newest)
+	}
+}
+
+// commit writes raw payload to slot, with valid header, as if it was saved by another firmware version.
+func commit(device *memoryDevice, slot int64, sequence uint32, payload []byte) {
+	start := slot * testSlotSize
+	device.EraseBlocks(start/eraseBlockSize, testSlotSize/eraseBlockSize)
+	device.WriteAt(payload, start+writeBlockSize)
+	page := make([]byte, writeBlockSize)
+	for i := range page {
+		page[i] = erased
+	}
+	header{sequence: sequence, length: uint32(len(payload)), checksum: crc32.ChecksumIEEE(payload)}.put(page)
+	device.WriteAt(page, start)
+}
+
+// record returns record of notification with given title, as stored in payload.
+func record(title string, read bool, extra int) []byte {
+	notification := protocol.AppendNotification(nil, protocol.Notification{Title: title})
+	flags := byte(0)
+	if read {
+		flags = flagRead
+	}
+	r := []byte{flags, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(r[1:], uint32(len(notification)+extra))
+	return append(r, notification...)
+}
+
+func TestTruncatedRecord(t *testing.T) {
+	device := newMemoryDevice()
+	s := open(t, device)
+	previous := snapshot(2, 1)
+	s.Save(previous)
+
+	// Checksum is valid, but record claims more bytes than payload has.
+	payload := append([]byte{settingsLength, 0, 0, 0}, record("newest", false, 0)...)
+	payload = append(payload, record("older", false, 100)...)
+	commit(device, 1, 2, payload)
+	if loaded := load(t, device); !reflect.DeepEqual(loaded, previous) {
+		t.Errorf("loaded %+v, want previous %+v", loaded, previous)
+	}
+
+	// Record header cut in the middle.
+	payload = append([]byte{settingsLength, 0, 0, 0}, record("newest", false, 0)...)
+	payload = append(payload, flagRead, 1)
+	commit(device, 1, 2, payload)
+	if loaded := load(t, device); !reflect.DeepEqual(loaded, previous) {
+		t.Errorf("loaded %+v, want previous %+v", loaded, previous)
+	}
+}
+
+func TestOlderSettings(t *testing.T) {
+	device := newMemoryDevice()
+	// Settings before depth was added: page and flags only.
+	payload := append([]byte{2, 7, settingGrouped}, record("newest", true, 0)...)
+	payload = append(payload, record("oldest", false, 0)...)
+	commit(device, 0, 1, payload)
+
+	loaded := load(t, device)
+	want := Snapshot{
+		Settings: Settings{Page: 7, Grouped: true, Depth: 0},
+		History: []Entry{
+			{Notification: protocol.Notification{Title: "oldest"}},
+			{Notification: protocol.Notification{Title: "newest"}, Read: true},
+		},
+	}
+	if !reflect.DeepEqual(loaded, want) {
+		t.Errorf("loaded %+v, want %+v", loaded, want)
+	}
+}
+
+func TestNewerSettings(t *testing.T) {
+	device := newMemoryDevice()
+	// Settings added by newer firmware are ignored.
+	payload := append([]byte{6, 3, 0, 40, 0xAA, 0xBB, 0xCC}, record("only", false, 0)...)
+	commit(device, 0, 1, payload)
+
+	loaded := load(t, device)
+	want := Snapshot{
+		Settings: Settings{Page: 3, Depth: 40},
+		History:  []Entry{{Notification: protocol.Notification{Title: "only"}}},
+	}
+	if !reflect.DeepEqual(loaded, want) {
+		t.Errorf("loaded %+v, want %+v", loaded, want)
+	}
+}
+
+func TestOtherFormatVersion(t *testing.T) {
+	device := newMemoryDevice()
+	s := open(t, device)
+	previous := snapshot(1, 1)
+	s.Save(previous)
+
+	// Snapshot of incompatible format is skipped, even if it is newer.
+	commit(device, 1, 2, []byte{settingsLength, 0, 0, 0})
+	device.data[testSlotSize+4] = FormatVersion + 1
+	if loaded := load(t, device); !reflect.DeepEqual(loaded, previous) {
+		t.Errorf("loaded %+v, want previous %+v", loaded, previous)
+	}
+}
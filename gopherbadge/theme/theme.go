@@ -0,0 +1,26 @@
+// Package theme holds colors, fonts and dimensions shared by notification history and other screens of the badge.
+package theme
+
+import (
+	"image/color"
+
+	"tinygo.org/x/tinyfont/freemono"
+)
+
+const (
+	ScreenWidth  int16 = 320
+	ScreenHeight int16 = 240
+	Margin       int16 = 8
+	LineHeight   int16 = 30 // Of text view with a single line of Font.
+)
+
+var (
+	Black  = color.RGBA{0, 0, 0, 255}
+	White  = color.RGBA{255, 255, 255, 255}
+	Red    = color.RGBA{255, 0, 0, 255}
+	Blue   = color.RGBA{0, 0, 255, 255}
+	Green  = color.RGBA{0, 255, 0, 255}
+	Violet = color.RGBA{116, 58, 213, 255}
+	Yellow = color.RGBA{255, 255, 0, 255}
+	Font   = &freemono.Regular9pt7b // Has glyphs for printable ASCII only, other text can be rendered by daemon.
+)
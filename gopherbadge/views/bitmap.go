@@ -0,0 +1,83 @@
+package views
+
+import (
+	"image/color"
+	"strconv"
+	"strings"
+
+	"tinygo.org/x/drivers/st7789"
+)
+
+const (
+	defaultStripHeight int16 = 20
+)
+
+// drawStrips draws text rendered by daemon, as bitmap strips below each other.
+// Strip is "width,height,pixels" with rows of hex encoded bits.
+// Lit bits are drawn in fontColor, the rest in backgroundColor. Strips not fitting in w and h are cut.
+func drawStrips(display *st7789.Device, x, y, w, h int16, strips []string, fontColor color.RGBA, backgroundColor color.RGBA) {
+	row := make([]color.RGBA, w)
+	top := y
+	for _, strip := range strips {
+		parts := strings.SplitN(strip, ",", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		stripWidth, err := strconv.Atoi(parts[0])
+		if err != nil {
+			continue
+		}
+		stripHeight, err := strconv.Atoi(parts[1])
+		if err != nil {
+			continue
+		}
+		if top+int16(stripHeight) > y+h {
+			return
+		}
+
+		pixels := parts[2]
+		rowBytes := (stripWidth + 7) / 8
+		visibleWidth := min(stripWidth, int(w))
+		for i := 0; i < stripHeight; i++ {
+			if len(pixels) < 2*rowBytes*(i+1) {
+				break
+			}
+			for j := 0; j < visibleWidth; j++ {
+				offset := 2 * (rowBytes*i + j/8)
+				value := hexValue(pixels[offset])<<4 | hexValue(pixels[offset+1])
+				if value&(0x80>>(j%8)) != 0 {
+					row[j] = fontColor
+				} else {
+					row[j] = backgroundColor
+				}
+			}
+			if visibleWidth > 0 {
+				display.FillRectangleWithBuffer(x, top+int16(i), int16(visibleWidth), 1, row[:visibleWidth])
+			}
+		}
+		top += int16(stripHeight)
+	}
+}
+
+// stripHeight returns height of the first strip, all strips rendered by daemon have the same height.
+func stripHeight(strips string) int16 {
+	parts := strings.SplitN(strips, ",", 3)
+	if len(parts) == 3 {
+		if height, err := strconv.Atoi(parts[1]); err == nil && height > 0 {
+			return int16(height)
+		}
+	}
+	return defaultStripHeight
+}
+
+func hexValue(character byte) byte {
+	switch {
+	case character >= '0' && character <= '9':
+		return character - '0'
+	case character >= 'a' && character <= 'f':
+		return character - 'a' + 10
+	case character >= 'A' && character <= 'F':
+		return character - 'A' + 10
+	}
+	return 0
+}
@@ -36,10 +36,7 @@ func (rv *RectView) SetBackgroundColor(color *color.RGBA) *RectView {
 }
 
 func (rv *RectView) Draw() *RectView {
-	rv.display.DrawFastHLine(rv.x, rv.x+rv.w-1, rv.y, *rv.color)
-	rv.display.DrawFastHLine(rv.x, rv.x+rv.w-1, rv.y+rv.h-1, *rv.color)
-	rv.display.DrawFastVLine(rv.x, rv.y, rv.y+rv.h-1, *rv.color)
-	rv.display.DrawFastVLine(rv.x+rv.w-1, rv.y, rv.y+rv.h-1, *rv.color)
+	rv.DrawBorder()
 	backgroundColor := color.RGBA{0, 0, 0, 255}
 	if rv.backgroundColor != nil {
 		backgroundColor = *rv.backgroundColor
@@ -47,3 +44,12 @@ func (rv *RectView) Draw() *RectView {
 	rv.display.FillRectangle(rv.x+1, rv.y+1, rv.w-2, rv.h-2, backgroundColor)
 	return rv
 }
+
+// DrawBorder draws only border, leaving inside of rectangle as it is. Used to change its color.
+func (rv *RectView) DrawBorder() *RectView {
+	rv.display.DrawFastHLine(rv.x, rv.x+rv.w-1, rv.y, *rv.color)
+	rv.display.DrawFastHLine(rv.x, rv.x+rv.w-1, rv.y+rv.h-1, *rv.color)
+	rv.display.DrawFastVLine(rv.x, rv.y, rv.y+rv.h-1, *rv.color)
+	rv.display.DrawFastVLine(rv.x+rv.w-1, rv.y, rv.y+rv.h-1, *rv.color)
+	return rv
+}
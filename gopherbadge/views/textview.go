@@ -2,14 +2,20 @@ package views
 
 import (
 	"image/color"
+	"strings"
 
 	"tinygo.org/x/drivers/st7789"
 	"tinygo.org/x/tinyfont"
+
+	"github.com/coltwillcox/ngn/gopherbadge/layout"
 )
 
 const (
-	padding  int16 = 8
-	ellipsis       = "..."
+	padding         int16 = 8
+	maximumWrapped        = 64 // Lines kept for scrolling, the rest of text is dropped.
+	scrollBarWidth  int16 = 2
+	lineSpacing     int16 = 5 // Pixels between lines, on top of font line advance.
+	bitmapSeparator       = ";"
 )
 
 type TextView struct {
@@ -17,9 +23,17 @@ type TextView struct {
 	color           *color.RGBA
 	backgroundColor *color.RGBA
 	fontColor       *color.RGBA
+	emphasisColor   *color.RGBA
 	font            tinyfont.Fonter
 	x, y, w, h      int16
+	text            string
 	lines           []string
+	starts          []int  // Offsets of lines in text.
+	emphasis        []Span // Parts of text drawn in emphasisColor.
+	bitmap          string // Text rendered by daemon, shown instead of lines.
+	scrollable      bool
+	scroll          int // First visible line.
+	truncated       bool
 	onDisplay       bool
 }
 
@@ -49,31 +63,67 @@ func (tv *TextView) SetFontColor(color *color.RGBA) *TextView {
 	return tv
 }
 
+func (tv *TextView) SetEmphasisColor(color *color.RGBA) *TextView {
+	tv.emphasisColor = color
+	return tv
+}
+
 func (tv *TextView) SetFont(font tinyfont.Fonter) *TextView {
 	tv.font = font
 	return tv
 }
 
 func (tv *TextView) SetText(text string) *TextView {
-	charHeight := tv.font.GetGlyph(rune('|')).Height
-	maximumLines := (tv.h - padding) / (int16(charHeight) + padding)
-
-	charWidth := tv.font.GetGlyph(rune('_')).Width
-	maximumChars := (tv.w - padding) / int16(charWidth)
-
-	chunkz := chunks(text, int(maximumChars), int(maximumLines))
-
-	if len(chunkz) > 0 && len(chunkz[len(chunkz)-1]) > int(maximumChars) {
-		chunkz[len(chunkz)-1] = chunkz[len(chunkz)-1][:maximumChars-int16(len(ellipsis))] + ellipsis
+	lines, starts := layout.Lines(tv.font, text, tv.textWidth(), maximumWrapped)
+	if text != tv.text || !compareSlices(tv.lines, lines) {
+		tv.text = text
+		tv.lines, tv.starts = lines, starts
+		tv.scroll = 0
+		tv.drawText()
 	}
+	return tv
+}
 
-	if !compareSlices(tv.lines, chunkz) {
-		tv.lines = chunkz
+// Set replaces text together with the way it is shown, drawing it only once, so page change does not flicker.
+// Bitmap strips rendered by daemon are shown instead of text unless empty, emphasized parts of text are drawn
+// in emphasis color, and scrollable view shows scroll bar instead of cutting text with ellipsis.
+func (tv *TextView) Set(text, bitmap string, emphasis []Span, scrollable bool) *TextView {
+	changed := tv.scrollable != scrollable || tv.bitmap != bitmap || !compareSpans(tv.emphasis, emphasis)
+	tv.scrollable, tv.bitmap, tv.emphasis = scrollable, bitmap, emphasis
+	// Scroll bar takes some width, so text is wrapped with scrollable already set.
+	lines, starts := layout.Lines(tv.font, text, tv.textWidth(), maximumWrapped)
+	if changed || text != tv.text || !compareSlices(tv.lines, lines) {
+		tv.text = text
+		tv.lines, tv.starts = lines, starts
+		tv.scroll = 0
 		tv.drawText()
 	}
 	return tv
 }
 
+// Scroll moves text by given number of lines, returns false if it can't move any further.
+func (tv *TextView) Scroll(lines int) bool {
+	scroll := tv.scroll + lines
+	if last := tv.lineCount() - tv.visibleLines(); scroll > last {
+		scroll = last
+	}
+	if scroll < 0 {
+		scroll = 0
+	}
+	if scroll == tv.scroll {
+		return false
+	}
+
+	tv.scroll = scroll
+	tv.drawText()
+	return true
+}
+
+// Truncated reports whether the whole text does not fit in view.
+func (tv *TextView) Truncated() bool {
+	return tv.truncated
+}
+
 func (tv *TextView) Draw() *TextView {
 	tv.display.DrawFastHLine(tv.x, tv.x+tv.w-1, tv.y, *tv.color)
 	tv.display.DrawFastHLine(tv.x, tv.x+tv.w-1, tv.y+tv.h-1, *tv.color)
@@ -86,28 +136,101 @@ func (tv *TextView) Draw() *TextView {
 	tv.display.FillRectangle(tv.x+1, tv.y+1, tv.w-2, tv.h-2, backgroundColor)
 	tv.onDisplay = true
 
-	if len(tv.lines) > 0 {
+	if len(tv.lines) > 0 || tv.bitmap != "" {
 		tv.drawText()
 	}
 
 	return tv
 }
 
+func (tv *TextView) lineHeight() int16 {
+	return int16(tv.font.GetYAdvance()) + lineSpacing
+}
+
+func (tv *TextView) maximumLines() int16 {
+	// The last line needs no spacing below it.
+	return (tv.h - padding + lineSpacing) / tv.lineHeight()
+}
+
+// textWidth returns width available for text in pixels.
+func (tv *TextView) textWidth() int {
+	width := tv.w - padding
+	if tv.scrollable {
+		width -= scrollBarWidth * 2
+	}
+	return int(width)
+}
+
+func (tv *TextView) lineCount() int {
+	if tv.bitmap != "" {
+		return strings.Count(tv.bitmap, bitmapSeparator) + 1
+	}
+	return len(tv.lines)
+}
+
+func (tv *TextView) visibleLines() int {
+	if tv.bitmap != "" {
+		return int((tv.h - padding) / stripHeight(tv.bitmap))
+	}
+	return int(tv.maximumLines())
+}
+
 func (tv *TextView) drawText() *TextView {
-	if tv.onDisplay {
-		charHeight := tv.font.GetGlyph(rune('|')).Height
-		backgroundColor := color.RGBA{0, 0, 0, 255}
-		fontColor := color.RGBA{255, 255, 255, 255}
-		if tv.backgroundColor != nil {
-			backgroundColor = *tv.backgroundColor
-		}
-		if tv.fontColor != nil {
-			fontColor = *tv.fontColor
+	tv.truncated = tv.lineCount() > tv.scroll+tv.visibleLines()
+	if !tv.onDisplay {
+		return tv
+	}
+
+	backgroundColor := color.RGBA{0, 0, 0, 255}
+	fontColor := color.RGBA{255, 255, 255, 255}
+	emphasisColor := fontColor
+	if tv.backgroundColor != nil {
+		backgroundColor = *tv.backgroundColor
+	}
+	if tv.fontColor != nil {
+		fontColor = *tv.fontColor
+	}
+	if tv.emphasisColor != nil {
+		emphasisColor = *tv.emphasisColor
+	}
+	tv.display.FillRectangle(tv.x+1, tv.y+1, tv.w-2, tv.h-2, backgroundColor)
+	if tv.scrollable && tv.lineCount() > tv.visibleLines() {
+		tv.drawScrollBar(fontColor)
+	}
+
+	if tv.bitmap != "" {
+		strips := strings.Split(tv.bitmap, bitmapSeparator)
+		drawStrips(tv.display, tv.x+padding/2, tv.y+padding/2, tv.w-padding, tv.h-padding, strips[tv.scroll:], fontColor, backgroundColor)
+		return tv
+	}
+
+	for i := 0; i < int(tv.maximumLines()) && tv.scroll+i < len(tv.lines); i++ {
+		line := tv.lines[tv.scroll+i]
+		if tv.truncated && !tv.scrollable && i == int(tv.maximumLines())-1 {
+			line = layout.Truncate(tv.font, line, tv.textWidth())
 		}
-		tv.display.FillRectangle(tv.x+1, tv.y+1, tv.w-2, tv.h-2, backgroundColor)
-		for i := 0; i < len(tv.lines); i++ {
-			tinyfont.WriteLine(tv.display, tv.font, tv.x+padding/2, tv.y+20+int16(i)*(int16(charHeight)+padding+padding/4), tv.lines[i], fontColor)
+		colors := make([]color.RGBA, 0, len(line))
+		for offset := range line {
+			if isEmphasized(tv.emphasis, tv.starts[tv.scroll+i]+offset) {
+				colors = append(colors, emphasisColor)
+			} else {
+				colors = append(colors, fontColor)
+			}
 		}
+		// Baseline leaves room for descenders at the bottom of the line.
+		baseline := tv.y + padding/2 + int16(tv.font.GetYAdvance()) - padding/4 + int16(i)*tv.lineHeight()
+		tinyfont.WriteLineColors(tv.display, tv.font, tv.x+padding/2, baseline, line, colors)
 	}
 	return tv
 }
+
+// drawScrollBar shows position of visible lines at the right edge of view.
+func (tv *TextView) drawScrollBar(barColor color.RGBA) {
+	trackX := tv.x + tv.w - padding/2 - scrollBarWidth
+	trackY := tv.y + padding/2
+	trackHeight := int(tv.h - padding)
+	total := tv.lineCount()
+	thumbHeight := trackHeight * tv.visibleLines() / total
+	thumbY := trackHeight * tv.scroll / total
+	tv.display.FillRectangle(trackX, trackY+int16(thumbY), scrollBarWidth, int16(thumbHeight), barColor)
+}
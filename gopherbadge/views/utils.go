@@ -1,28 +1,43 @@
 package views
 
-func chunks(text string, chunkSize int, maximumChunks int) []string {
-	if len(text) == 0 {
-		return []string{}
-	}
-	if chunkSize >= len(text) {
-		return []string{text}
-	}
-	var chunks []string = make([]string, 0, maximumChunks)
-	currentLength := 0
-	currentStart := 0
-	for i := range text {
-		if currentLength == chunkSize {
-			chunks = append(chunks, text[currentStart:i])
-			currentLength = 0
-			currentStart = i
+import (
+	"strconv"
+	"strings"
+)
+
+// Span is a part of text, as byte offsets [Start, End).
+type Span struct {
+	Start, End int
+}
+
+// ParseSpans decodes spans sent by daemon as "start-end" pairs separated by comma, shifted by offset.
+func ParseSpans(spans string, offset int) []Span {
+	result := make([]Span, 0)
+	for _, part := range strings.Split(spans, ",") {
+		start, end, ok := strings.Cut(part, "-")
+		if !ok {
+			continue
+		}
+		startValue, err := strconv.Atoi(start)
+		if err != nil {
+			continue
 		}
-		currentLength++
-		if len(chunks) >= maximumChunks-1 {
-			break
+		endValue, err := strconv.Atoi(end)
+		if err != nil || endValue < startValue {
+			continue
 		}
+		result = append(result, Span{Start: startValue + offset, End: endValue + offset})
 	}
-	chunks = append(chunks, text[currentStart:])
-	return chunks
+	return result
+}
+
+func isEmphasized(spans []Span, offset int) bool {
+	for _, span := range spans {
+		if offset >= span.Start && offset < span.End {
+			return true
+		}
+	}
+	return false
 }
 
 func compareSlices(a, b []string) bool {
@@ -38,3 +53,16 @@ func compareSlices(a, b []string) bool {
 	}
 	return true
 }
+
+func compareSpans(a, b []Span) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
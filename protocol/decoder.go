@@ -0,0 +1,429 @@
+package protocol
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	Separator          = '*' // Ends every message sent to the badge.
+	maximumValueLength = 32 * 1024
+	maximumDepth       = 8
+)
+
+var (
+	ErrSyntax   = errors.New("invalid JSON")
+	ErrTooLarge = errors.New("value too large")
+)
+
+type decoderState uint8
+
+const (
+	stateIdle decoderState = iota // Outside of object, reading command.
+	stateKeyOrEnd
+	stateKey
+	stateColon
+	stateValue
+	stateString
+	stateLiteral
+	stateNested
+	stateCommaOrEnd
+	stateSkip // After error, until Separator.
+)
+
+// Message is either a command (e.g. "clear"), a widget (its Kind is not empty) or a notification.
+type Message struct {
+	Command      string
+	Argument     string // Of command, e.g. notification ID of CommandRead.
+	Notification Notification
+	Widget       Widget
+}
+
+// Field returns Notification field stored under JSON key, or nil for unknown key.
+// It must match JSON tags, decoder uses it instead of reflection, which TinyGo supports only partially.
+func (n *Notification) Field(key string) *string {
+	switch key {
+	case "id":
+		return &n.ID
+	case "program":
+		return &n.Program
+	case "title":
+		return &n.Title
+	case "body":
+		return &n.Body
+	case "sender":
+		return &n.Sender
+	case "serial":
+		return &n.Serial
+	case "created_at":
+		return &n.CreatedAt
+	case "icon":
+		return &n.Icon
+	case "urgency":
+		return &n.Urgency
+	case "sticky":
+		return &n.Sticky
+	case "color":
+		return &n.Color
+	case "links":
+		return &n.Links
+	case "emphasis":
+		return &n.Emphasis
+	case "title_bitmap":
+		return &n.TitleBitmap
+	case "body_bitmap":
+		return &n.BodyBitmap
+	}
+	return nil
+}
+
+// Field returns Widget field stored under JSON key, or nil for unknown key. Like Notification.Field, it must match JSON tags.
+func (w *Widget) Field(key string) *string {
+	switch key {
+	case "widget":
+		return &w.Kind
+	case "player":
+		return &w.Player
+	case "status":
+		return &w.Status
+	case "title":
+		return &w.Title
+	case "artist":
+		return &w.Artist
+	case "album":
+		return &w.Album
+	case "art":
+		return &w.Art
+	case "art_id":
+		return &w.ArtID
+	case "cpu":
+		return &w.CPU
+	case "memory":
+		return &w.Memory
+	case "load":
+		return &w.Load
+	case "uptime":
+		return &w.Uptime
+	case "phase":
+		return &w.Phase
+	case "remaining":
+		return &w.Remaining
+	case "round":
+		return &w.Round
+	}
+	return nil
+}
+
+// ParseTime parses argument of CommandTime into Unix time and UTC offset in seconds.
+func ParseTime(argument string) (unix int64, offset int, ok bool) {
+	unixText, offsetText, found := strings.Cut(argument, ",")
+	unix, err := strconv.ParseInt(unixText, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if found {
+		if offset, err = strconv.Atoi(offsetText); err != nil {
+			return 0, 0, false
+		}
+	}
+	return unix, offset, true
+}
+
+// ParseAction parses argument of CommandAction into widget kind and action.
+func ParseAction(argument string) (kind, action string, ok bool) {
+	kind, action, ok = strings.Cut(argument, ",")
+	return kind, action, ok && kind != "" && action != ""
+}
+
+// Decoder reads messages from a stream one byte at a time, without buffering whole message.
+// Commands are plain words followed by Separator, notifications are JSON objects (Separator after them is optional).
+// Non-string values are stored as their JSON text, null as empty string, nested objects and arrays are skipped.
+// After invalid input, everything up to the next Separator is dropped.
+// Separator is never part of a message, encoder escapes it inside of strings, so a raw one ends the frame in any state.
+// A frame cut off by a lost chunk is then dropped with ErrSyntax, instead of swallowing the next one.
+type Decoder struct {
+	state        decoderState
+	notification Notification
+	widget       Widget
+	keys         int     // Keys read in current object.
+	isWidget     bool    // Object started with "widget" key.
+	buffer       []byte  // Command, key, or value being read.
+	target       *string // Field of current value, nil if it is not stored.
+	escape       bool
+	hex          []byte // Digits of \u escape being read.
+	surrogate    rune   // High surrogate waiting for its pair.
+	depth        int    // Of nested value being skipped.
+	nestedString bool
+}
+
+// Feed passes next byte to decoder. When a message is complete, it is returned with true.
+func (d *Decoder) Feed(b byte) (Message, bool, error) {
+	if b == Separator && d.state != stateIdle {
+		truncated := d.state != stateSkip
+		d.reset()
+		if truncated {
+			return Message{}, false, ErrSyntax
+		}
+		return Message{}, false, nil
+	}
+
+	switch d.state {
+	case stateIdle:
+		switch {
+		case b == '{' && len(d.buffer) == 0:
+			d.notification = Notification{}
+			d.widget, d.keys, d.isWidget = Widget{}, 0, false
+			d.state = stateKeyOrEnd
+		case b == Separator:
+			command, argument, _ := strings.Cut(string(d.buffer), string(ArgumentSeparator))
+			d.buffer = d.buffer[:0]
+			return Message{Command: command, Argument: argument}, command != "", nil
+		case isSpace(b):
+		default:
+			return d.append(b)
+		}
+	case stateKeyOrEnd:
+		switch {
+		case b == '"':
+			d.startString(stateKey)
+		case b == '}':
+			return d.finish()
+		case !isSpace(b):
+			return d.fail(ErrSyntax)
+		}
+	case stateKey, stateString:
+		return d.readString(b)
+	case stateColon:
+		switch {
+		case b == ':':
+			d.state = stateValue
+		case !isSpace(b):
+			return d.fail(ErrSyntax)
+		}
+	case stateValue:
+		switch {
+		case b == '"':
+			d.startString(stateString)
+		case b == '{' || b == '[':
+			d.depth, d.nestedString, d.escape = 1, false, false
+			d.state = stateNested
+		case b == '-' || (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z'):
+			d.buffer = append(d.buffer[:0], b)
+			d.state = stateLiteral
+		case !isSpace(b):
+			return d.fail(ErrSyntax)
+		}
+	case stateLiteral:
+		switch {
+		case b == ',' || b == '}' || isSpace(b):
+			literal := string(d.buffer)
+			if literal == "null" {
+				literal = ""
+			}
+			d.store(literal)
+			d.state = stateCommaOrEnd
+			return d.Feed(b)
+		case b == '-' || b == '+' || b == '.' || (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z'):
+			return d.append(b)
+		default:
+			return d.fail(ErrSyntax)
+		}
+	case stateNested:
+		return d.skipNested(b)
+	case stateCommaOrEnd:
+		switch {
+		case b == ',':
+			d.state = stateKeyOrEnd
+		case b == '}':
+			return d.finish()
+		case !isSpace(b):
+			return d.fail(ErrSyntax)
+		}
+	}
+
+	return Message{}, false, nil
+}
+
+func (d *Decoder) startString(state decoderState) {
+	d.buffer = d.buffer[:0]
+	d.escape, d.hex, d.surrogate = false, d.hex[:0], 0
+	d.state = state
+}
+
+func (d *Decoder) readString(b byte) (Message, bool, error) {
+	switch {
+	case len(d.hex) > 0 || (d.escape && b == 'u'):
+		if d.escape {
+			d.escape = false
+			d.hex = append(d.hex[:0], 'u')
+			return Message{}, false, nil
+		}
+		if !isHex(b) {
+			return d.fail(ErrSyntax)
+		}
+		d.hex = append(d.hex, b)
+		if len(d.hex) == 5 {
+			d.appendRune(hexRune(d.hex[1:]))
+			d.hex = d.hex[:0]
+		}
+		return Message{}, false, nil
+	case d.escape:
+		d.escape = false
+		switch b {
+		case '"', '\\', '/':
+		case 'b':
+			b = '\b'
+		case 'f':
+			b = '\f'
+		case 'n':
+			b = '\n'
+		case 'r':
+			b = '\r'
+		case 't':
+			b = '\t'
+		default:
+			return d.fail(ErrSyntax)
+		}
+		d.flushSurrogate()
+		return d.append(b)
+	case b == '\\':
+		d.escape = true
+		return Message{}, false, nil
+	case b == '"':
+		d.flushSurrogate()
+		if d.state == stateKey {
+			key := string(d.buffer)
+			d.isWidget = d.isWidget || (d.keys == 0 && key == "widget")
+			d.keys++
+			if d.isWidget {
+				d.target = d.widget.Field(key)
+			} else {
+				d.target = d.notification.Field(key)
+			}
+			d.state = stateColon
+		} else {
+			d.store(string(d.buffer))
+			d.state = stateCommaOrEnd
+		}
+		return Message{}, false, nil
+	}
+	d.flushSurrogate()
+	return d.append(b)
+}
+
+// appendRune writes rune from \u escape, joining UTF-16 surrogate pairs.
+func (d *Decoder) appendRune(r rune) {
+	if d.surrogate != 0 {
+		pair := utf16.DecodeRune(d.surrogate, r)
+		d.surrogate = 0
+		if pair != utf8.RuneError {
+			d.buffer = utf8.AppendRune(d.buffer, pair)
+			return
+		}
+		d.buffer = utf8.AppendRune(d.buffer, utf8.RuneError)
+	}
+	if utf16.IsSurrogate(r) {
+		d.surrogate = r
+		return
+	}
+	d.buffer = utf8.AppendRune(d.buffer, r)
+}
+
+// flushSurrogate writes replacement for high surrogate without its pair.
+func (d *Decoder) flushSurrogate() {
+	if d.surrogate != 0 {
+		d.buffer = utf8.AppendRune(d.buffer, utf8.RuneError)
+		d.surrogate = 0
+	}
+}
+
+func (d *Decoder) skipNested(b byte) (Message, bool, error) {
+	switch {
+	case d.nestedString && d.escape:
+		d.escape = false
+	case d.nestedString && b == '\\':
+		d.escape = true
+	case b == '"':
+		d.nestedString = !d.nestedString
+	case d.nestedString:
+	case b == '{' || b == '[':
+		d.depth++
+		if d.depth > maximumDepth {
+			return d.fail(ErrSyntax)
+		}
+	case b == '}' || b == ']':
+		d.depth--
+		if d.depth == 0 {
+			d.store("")
+			d.state = stateCommaOrEnd
+		}
+	}
+	return Message{}, false, nil
+}
+
+func (d *Decoder) append(b byte) (Message, bool, error) {
+	if len(d.buffer) >= maximumValueLength {
+		return d.fail(ErrTooLarge)
+	}
+	d.buffer = append(d.buffer, b)
+	return Message{}, false, nil
+}
+
+func (d *Decoder) store(value string) {
+	if d.target != nil {
+		*d.target = value
+		d.target = nil
+	}
+	d.buffer = d.buffer[:0]
+}
+
+func (d *Decoder) finish() (Message, bool, error) {
+	message := Message{Notification: d.notification}
+	if d.isWidget {
+		message = Message{Widget: d.widget}
+	}
+	d.reset()
+	return message, true, nil
+}
+
+func (d *Decoder) fail(err error) (Message, bool, error) {
+	d.reset()
+	d.state = stateSkip
+	return Message{}, false, err
+}
+
+func (d *Decoder) reset() {
+	d.state = stateIdle
+	d.notification = Notification{}
+	d.widget, d.keys, d.isWidget = Widget{}, 0, false
+	d.buffer = d.buffer[:0]
+	d.target = nil
+	d.escape, d.hex, d.surrogate = false, d.hex[:0], 0
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
+
+func isHex(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
+}
+
+func hexRune(digits []byte) rune {
+	value := rune(0)
+	for _, digit := range digits {
+		value <<= 4
+		switch {
+		case digit >= '0' && digit <= '9':
+			value |= rune(digit - '0')
+		case digit >= 'a' && digit <= 'f':
+			value |= rune(digit-'a') + 10
+		case digit >= 'A' && digit <= 'F':
+			value |= rune(digit-'A') + 10
+		}
+	}
+	return value
+}
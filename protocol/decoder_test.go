@@ -0,0 +1,234 @@
+package protocol
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// decode feeds data to decoder, returning complete messages and errors in order they occurred.
+func decode(d *Decoder, data string) ([]Message, []error) {
+	var messages []Message
+	var errs []error
+	for i := 0; i < len(data); i++ {
+		message, ok, err := d.Feed(data[i])
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if ok {
+			messages = append(messages, message)
+		}
+	}
+	return messages, errs
+}
+
+func TestDecoderNotification(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		notification Notification
+	}{
+		{"empty", `{}`, Notification{}},
+		{"fields", `{"id":"1","title":"Hello","body":"World"}`, Notification{ID: "1", Title: "Hello", Body: "World"}},
+		{"whitespace", " { \"title\" : \"a\" ,\n\t\"body\":\"b\" } ", Notification{Title: "a", Body: "b"}},
+		{"escapes", `{"title":"\"\\\/\b\f\n\r\t"}`, Notification{Title: "\"\\/\b\f\n\r\t"}},
+		{"unicode escapes", `{"title":"\u0041\u00e9\u4e16"}`, Notification{Title: "A\u00e9\u4e16"}},
+		{"surrogate pair", `{"title":"\ud83d\ude00"}`, Notification{Title: "\U0001f600"}},
+		{"upper case hex", `{"title":"\uD83D\uDE00"}`, Notification{Title: "\U0001f600"}},
+		{"lone high surrogate", `{"title":"\ud83dx"}`, Notification{Title: "\uFFFDx"}},
+		{"lone high surrogate at end", `{"title":"\ud83d"}`, Notification{Title: "\uFFFD"}},
+		{"high surrogate without pair", `{"title":"\ud83d\u0041"}`, Notification{Title: "\uFFFDA"}},
+		{"lone low surrogate", `{"title":"\ude00"}`, Notification{Title: "\uFFFD"}},
+		{"raw UTF-8", `{"title":"Здраво 世界"}`, Notification{Title: "Здраво 世界"}},
+		{"escaped separator", `{"title":"a\u002ab","body":"\u002A"}`, Notification{Title: "a*b", Body: "*"}},
+		{"literals", `{"title":123,"body":-1.5e3,"sticky":true,"color":null}`, Notification{Title: "123", Body: "-1.5e3", Sticky: "true"}},
+		{"unknown keys", `{"unknown":"x","title":"a","other":1}`, Notification{Title: "a"}},
+		{"nested values skipped", `{"title":"a","extra":{"x":[1,{"y":"}]\""}]},"body":"b"}`, Notification{Title: "a", Body: "b"}},
+		{"nested value on known key", `{"title":["a"]}`, Notification{}},
+		{"duplicate key", `{"title":"a","title":"b"}`, Notification{Title: "b"}},
+		{"widget key not first", `{"title":"a","widget":"stats"}`, Notification{Title: "a"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			messages, errs := decode(&Decoder{}, test.input)
+			if len(errs) != 0 {
+				t.Fatalf("unexpected errors %v", errs)
+			}
+			if len(messages) != 1 {
+				t.Fatalf("got %d messages, want 1", len(messages))
+			}
+			if messages[0].Notification != test.notification || messages[0].Widget.Kind != "" || messages[0].Command != "" {
+				t.Errorf("got %+v, want notification %+v", messages[0], test.notification)
+			}
+		})
+	}
+}
+
+func TestDecoderWidget(t *testing.T) {
+	messages, errs := decode(&Decoder{}, `{"widget":"stats","cpu":"12","title":"ignored"}`)
+	if len(errs) != 0 || len(messages) != 1 {
+		t.Fatalf("got %v %v", messages, errs)
+	}
+	want := Widget{Kind: WidgetStats, CPU: "12", Title: "ignored"}
+	if messages[0].Widget != want || messages[0].Notification != (Notification{}) {
+		t.Errorf("got %+v, want widget %+v", messages[0], want)
+	}
+}
+
+func TestDecoderCommands(t *testing.T) {
+	messages, errs := decode(&Decoder{}, "clear*read:abc*time:1700000000,3600* *")
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+	want := []Message{
+		{Command: CommandClear},
+		{Command: CommandRead, Argument: "abc"},
+		{Command: CommandTime, Argument: "1700000000,3600"},
+	}
+	if len(messages) != len(want) {
+		t.Fatalf("got %+v, want %+v", messages, want)
+	}
+	for i := range want {
+		if messages[i] != want[i] {
+			t.Errorf("message %d = %+v, want %+v", i, messages[i], want[i])
+		}
+	}
+}
+
+// TestDecoderChunks splits stream at every position, decoder must keep its state between chunks.
+func TestDecoderChunks(t *testing.T) {
+	stream := `clear*{"title":"a\"\u002aé","extra":[{"x":"]"}],"body":"b"}*read:1*{"widget":"pomodoro","phase":"work"}*`
+	want, errs := decode(&Decoder{}, stream)
+	if len(errs) != 0 || len(want) != 4 {
+		t.Fatalf("whole stream decoded to %+v %v", want, errs)
+	}
+	for split := 1; split < len(stream); split++ {
+		d := &Decoder{}
+		first, firstErrs := decode(d, stream[:split])
+		second, secondErrs := decode(d, stream[split:])
+		messages := append(first, second...)
+		if len(firstErrs)+len(secondErrs) != 0 || len(messages) != len(want) {
+			t.Fatalf("split at %d decoded to %+v %v %v", split, messages, firstErrs, secondErrs)
+		}
+		for i := range want {
+			if messages[i] != want[i] {
+				t.Errorf("split at %d: message %d = %+v, want %+v", split, i, messages[i], want[i])
+			}
+		}
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   error
+	}{
+		{"missing colon", `{"title" "a"}`, ErrSyntax},
+		{"missing comma", `{"title":"a" "body":"b"}`, ErrSyntax},
+		{"invalid escape", `{"title":"\x"}`, ErrSyntax},
+		{"invalid hex", `{"title":"\u00g0"}`, ErrSyntax},
+		{"invalid value", `{"title":'a'}`, ErrSyntax},
+		{"invalid literal", `{"title":tr#e}`, ErrSyntax},
+		{"too deep", `{"extra":` + strings.Repeat("[", maximumDepth+1) + strings.Repeat("]", maximumDepth+1) + `}`, ErrSyntax},
+		{"oversize value", `{"title":"` + strings.Repeat("a", maximumValueLength+1) + `"}`, ErrTooLarge},
+		{"oversize command", strings.Repeat("a", maximumValueLength+1), ErrTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := &Decoder{}
+			messages, errs := decode(d, test.input)
+			if len(messages) != 0 || len(errs) != 1 || !errors.Is(errs[0], test.err) {
+				t.Fatalf("got %+v %v, want error %v", messages, errs, test.err)
+			}
+
+			// Everything up to the next separator is dropped, then decoder works again.
+			messages, errs = decode(d, `"}]}*{"title":"next"}`)
+			if len(errs) != 0 || len(messages) != 1 || messages[0].Notification.Title != "next" {
+				t.Errorf("after error got %+v %v", messages, errs)
+			}
+		})
+	}
+}
+
+// TestDecoderTruncated cuts frame off in every state, raw separator must drop it and let the next frame through.
+func TestDecoderTruncated(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"object start", `{`},
+		{"key", `{"tit`},
+		{"before colon", `{"title"`},
+		{"value", `{"title":`},
+		{"string", `{"title":"abc`},
+		{"escape", `{"title":"\`},
+		{"unicode escape", `{"title":"\u00`},
+		{"high surrogate", `{"title":"\ud83d`},
+		{"literal", `{"title":12`},
+		{"nested", `{"extra":[{"x":1`},
+		{"nested string", `{"extra":["]`},
+		{"before end", `{"title":"a"`},
+		{"widget", `{"widget":"stats","cpu":"1`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			messages, errs := decode(&Decoder{}, test.input+`*{"title":"next"}*`)
+			if len(errs) != 1 || !errors.Is(errs[0], ErrSyntax) {
+				t.Errorf("got errors %v, want single %v", errs, ErrSyntax)
+			}
+			if len(messages) != 1 || messages[0].Notification != (Notification{Title: "next"}) {
+				t.Errorf("got %+v, want only the next notification", messages)
+			}
+		})
+	}
+
+	// After an error, separator only ends the skipped frame.
+	messages, errs := decode(&Decoder{}, `{"title" x*clear*`)
+	if len(errs) != 1 || len(messages) != 1 || messages[0].Command != CommandClear {
+		t.Errorf("after error got %+v %v", messages, errs)
+	}
+}
+
+func TestDecoderMaximumValue(t *testing.T) {
+	title := strings.Repeat("a", maximumValueLength)
+	messages, errs := decode(&Decoder{}, `{"title":"`+title+`"}`)
+	if len(errs) != 0 || len(messages) != 1 || messages[0].Notification.Title != title {
+		t.Errorf("value of maximum length not decoded: %v", errs)
+	}
+}
+
+func FuzzDecoder(f *testing.F) {
+	f.Add([]byte(`{"title":"a","body":"b"}`))
+	f.Add([]byte(`clear*read:1*`))
+	f.Add([]byte(`{"widget":"stats","cpu":"1"}`))
+	f.Add([]byte(`{"title":"\ud83d\ude00A\n","extra":[{"a":"]"}],"n":-1}*`))
+	f.Add([]byte("{\"title\":\"\xff\xfe*\"}"))
+	f.Add([]byte(`{"title":"truncated`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Any input is decoded without panics, and after separator the decoder takes next frame whatever came before.
+		d := &Decoder{}
+		decode(d, string(data))
+		next := Notification{Title: "next"}
+		messages, _ := decode(d, string(Separator)+string(AppendNotification(nil, next)))
+		if len(messages) == 0 || messages[len(messages)-1].Notification != next {
+			t.Errorf("after %q decoded %+v, want next notification", data, messages)
+		}
+
+		// Any text round-trips through encoder, unless it is too large.
+		if len(data) >= maximumValueLength {
+			return
+		}
+		text := string(data)
+		n := Notification{ID: text, Title: text, Body: text + "*", Emphasis: text}
+		messages, errs := decode(&Decoder{}, string(AppendNotification(nil, n)))
+		if len(errs) != 0 || len(messages) != 1 || messages[0].Notification != n {
+			t.Errorf("notification %+v decoded to %+v %v", n, messages, errs)
+		}
+		w := Widget{Kind: WidgetPlaying, Title: text, Art: text}
+		messages, errs = decode(&Decoder{}, string(AppendWidget(nil, w)))
+		if len(errs) != 0 || len(messages) != 1 || messages[0].Widget != w {
+			t.Errorf("widget %+v decoded to %+v %v", w, messages, errs)
+		}
+	})
+}
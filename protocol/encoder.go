@@ -0,0 +1,132 @@
+package protocol
+
+import (
+	"strconv"
+)
+
+const hexDigits = "0123456789abcdef"
+
+// notificationKeys are JSON keys of Notification, in the order they are encoded.
+var notificationKeys = []string{
+	"id", "program", "title", "body", "sender", "serial", "created_at", "icon",
+	"urgency", "sticky", "color", "links", "emphasis", "title_bitmap", "body_bitmap",
+}
+
+// widgetKeys are JSON keys of Widget after its kind, in the order they are encoded.
+var widgetKeys = []string{
+	"player", "status", "title", "artist", "album", "art", "art_id",
+	"cpu", "memory", "load", "uptime",
+	"phase", "remaining", "round",
+}
+
+// AppendNotification appends n as JSON object followed by Separator to dst. Empty fields are omitted.
+// Unlike encoding/json, it needs no reflection, so TinyGo can use it too.
+func AppendNotification(dst []byte, n Notification) []byte {
+	dst = append(dst, '{')
+	dst = appendFields(dst, notificationKeys, n.Field, true)
+	return append(dst, '}', Separator)
+}
+
+// AppendWidget appends w as JSON object followed by Separator to dst. Empty fields are omitted, except its kind.
+func AppendWidget(dst []byte, w Widget) []byte {
+	dst = append(dst, `{"widget":`...)
+	dst = appendString(dst, w.Kind)
+	dst = appendFields(dst, widgetKeys, w.Field, false)
+	return append(dst, '}', Separator)
+}
+
+// appendFields appends non-empty fields under keys as JSON members, separated by comma.
+func appendFields(dst []byte, keys []string, field func(key string) *string, first bool) []byte {
+	for _, key := range keys {
+		value := *field(key)
+		if value == "" {
+			continue
+		}
+		if !first {
+			dst = append(dst, ',')
+		}
+		first = false
+		dst = appendString(dst, key)
+		dst = append(dst, ':')
+		dst = appendString(dst, value)
+	}
+	return dst
+}
+
+// AppendCommand appends command followed by Separator to dst.
+func AppendCommand(dst []byte, command string) []byte {
+	return append(append(dst, command...), Separator)
+}
+
+// AppendCommandArgument appends command with argument, followed by Separator to dst.
+func AppendCommandArgument(dst []byte, command string, argument string) []byte {
+	dst = append(dst, command...)
+	dst = append(dst, ArgumentSeparator)
+	return append(append(dst, argument...), Separator)
+}
+
+// AppendRead appends CommandRead with notification ID, followed by Separator to dst.
+func AppendRead(dst []byte, id string) []byte {
+	return AppendCommandArgument(dst, CommandRead, id)
+}
+
+// AppendTime appends CommandTime with Unix time and UTC offset in seconds, followed by Separator to dst.
+func AppendTime(dst []byte, unix int64, offset int) []byte {
+	dst = append(dst, CommandTime...)
+	dst = append(dst, ArgumentSeparator)
+	dst = strconv.AppendInt(dst, unix, 10)
+	dst = append(dst, ',')
+	dst = strconv.AppendInt(dst, int64(offset), 10)
+	return append(dst, Separator)
+}
+
+// AppendAction appends CommandAction with widget kind and action, followed by Separator to dst.
+func AppendAction(dst []byte, kind, action string) []byte {
+	return AppendCommandArgument(dst, CommandAction, kind+","+action)
+}
+
+// AppendCapabilities appends c as JSON object followed by Separator to dst.
+func AppendCapabilities(dst []byte, c Capabilities) []byte {
+	dst = append(dst, `{"version":`...)
+	dst = strconv.AppendInt(dst, int64(c.Version), 10)
+	dst = append(dst, `,"charset":`...)
+	dst = appendString(dst, c.Charset)
+	dst = append(dst, `,"bitmap":`...)
+	dst = strconv.AppendBool(dst, c.Bitmap)
+	dst = append(dst, `,"history":`...)
+	dst = strconv.AppendInt(dst, int64(c.History), 10)
+	if len(c.Widgets) != 0 {
+		dst = append(dst, `,"widgets":[`...)
+		for i, kind := range c.Widgets {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = appendString(dst, kind)
+		}
+		dst = append(dst, ']')
+	}
+	return append(dst, '}', Separator)
+}
+
+// appendString appends s as quoted JSON string. Separator is escaped too, decoder takes a raw one as the end of frame.
+func appendString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		switch {
+		case b == '"' || b == '\\':
+			dst = append(dst, '\\', b)
+		case b == '\n':
+			dst = append(dst, '\\', 'n')
+		case b == '\r':
+			dst = append(dst, '\\', 'r')
+		case b == '\t':
+			dst = append(dst, '\\', 't')
+		case b < 0x20 || b == Separator:
+			dst = append(dst, '\\', 'u', '0', '0', hexDigits[b>>4], hexDigits[b&0xf])
+		default:
+			dst = append(dst, b)
+		}
+	}
+	return append(dst, '"')
+}
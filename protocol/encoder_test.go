@@ -0,0 +1,156 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// text exercises escaping: quotes, backslash, control characters, separator and non-ASCII.
+const text = "a\"b\\c\nd\re\tf\x01g*h/é世\U0001f600"
+
+// jsonKeys returns JSON keys of string fields of struct type, in field order. Fields not transmitted are skipped.
+func jsonKeys(t *testing.T, v any) []string {
+	var keys []string
+	structType := reflect.TypeOf(v)
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if key == "-" {
+			continue
+		}
+		if field.Type.Kind() != reflect.String || key == "" {
+			t.Fatalf("%s.%s must be string with JSON key", structType.Name(), field.Name)
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// fill sets every transmitted field to a distinct value, through its JSON key.
+func fill(keys []string, field func(key string) *string) {
+	for _, key := range keys {
+		*field(key) = key + ":" + text
+	}
+}
+
+func TestKeys(t *testing.T) {
+	if keys := jsonKeys(t, Notification{}); !slices.Equal(keys, notificationKeys) {
+		t.Errorf("notificationKeys = %q, want JSON keys of Notification %q", notificationKeys, keys)
+	}
+	if keys := jsonKeys(t, Widget{}); !slices.Equal(keys, append([]string{"widget"}, widgetKeys...)) {
+		t.Errorf("widgetKeys = %q, want JSON keys of Widget after its kind %q", widgetKeys, keys)
+	}
+}
+
+func TestField(t *testing.T) {
+	n := Notification{}
+	for i, key := range jsonKeys(t, n) {
+		if field := n.Field(key); field != reflect.ValueOf(&n).Elem().Field(i).Addr().Interface() {
+			t.Errorf("Notification.Field(%q) does not return its field", key)
+		}
+	}
+	w := Widget{}
+	for i, key := range jsonKeys(t, w) {
+		if field := w.Field(key); field != reflect.ValueOf(&w).Elem().Field(i).Addr().Interface() {
+			t.Errorf("Widget.Field(%q) does not return its field", key)
+		}
+	}
+	if n.Field("unknown") != nil || w.Field("unknown") != nil {
+		t.Error("Field returns field for unknown key")
+	}
+}
+
+func TestNotificationRoundTrip(t *testing.T) {
+	n := Notification{}
+	fill(notificationKeys, n.Field)
+	encoded := AppendNotification(nil, n)
+	if encoded[len(encoded)-1] != Separator || bytes.Count(encoded, []byte{Separator}) != 1 {
+		t.Fatalf("%s does not end with the only raw separator", encoded)
+	}
+
+	unmarshaled := Notification{}
+	if err := json.Unmarshal(encoded[:len(encoded)-1], &unmarshaled); err != nil || unmarshaled != n {
+		t.Errorf("encoding/json decoded %s to %+v %v, want %+v", encoded, unmarshaled, err, n)
+	}
+	messages, errs := decode(&Decoder{}, string(encoded))
+	if len(errs) != 0 || len(messages) != 1 || messages[0].Notification != n {
+		t.Errorf("Decoder decoded %s to %+v %v, want %+v", encoded, messages, errs, n)
+	}
+
+	marshaled, err := json.Marshal(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// encoding/json leaves separator raw, which would end the frame.
+	marshaled = bytes.ReplaceAll(marshaled, []byte{Separator}, []byte(`\u002a`))
+	messages, errs = decode(&Decoder{}, string(marshaled))
+	if len(errs) != 0 || len(messages) != 1 || messages[0].Notification != n {
+		t.Errorf("Decoder decoded encoding/json %s to %+v %v, want %+v", marshaled, messages, errs, n)
+	}
+}
+
+func TestNotificationOmitsEmpty(t *testing.T) {
+	n := Notification{Title: "a", IconPath: "/tmp/icon.png"}
+	if encoded := string(AppendNotification(nil, n)); encoded != `{"title":"a"}*` {
+		t.Errorf("AppendNotification(%+v) = %s", n, encoded)
+	}
+	if encoded := string(AppendNotification(nil, Notification{})); encoded != `{}*` {
+		t.Errorf("AppendNotification of empty notification = %s", encoded)
+	}
+}
+
+func TestWidgetRoundTrip(t *testing.T) {
+	w := Widget{}
+	fill(jsonKeys(t, w), w.Field)
+	encoded := AppendWidget(nil, w)
+
+	unmarshaled := Widget{}
+	if err := json.Unmarshal(encoded[:len(encoded)-1], &unmarshaled); err != nil || unmarshaled != w {
+		t.Errorf("encoding/json decoded %s to %+v %v, want %+v", encoded, unmarshaled, err, w)
+	}
+	messages, errs := decode(&Decoder{}, string(encoded))
+	if len(errs) != 0 || len(messages) != 1 || messages[0].Widget != w {
+		t.Errorf("Decoder decoded %s to %+v %v, want %+v", encoded, messages, errs, w)
+	}
+
+	// Kind is always encoded first, even empty, so the decoder can tell widget from notification.
+	if encoded := string(AppendWidget(nil, Widget{Kind: WidgetStats, CPU: "1"})); encoded != `{"widget":"stats","cpu":"1"}*` {
+		t.Errorf("AppendWidget = %s", encoded)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	tests := []Capabilities{
+		{Version: Version, Charset: CharsetASCII, Bitmap: true, History: 100, Widgets: []string{WidgetPlaying, WidgetStats}},
+		{Version: 1, Charset: CharsetUTF8},
+	}
+	for _, c := range tests {
+		encoded := AppendCapabilities(nil, c)
+		unmarshaled := Capabilities{}
+		if err := json.Unmarshal(encoded[:len(encoded)-1], &unmarshaled); err != nil || !reflect.DeepEqual(unmarshaled, c) {
+			t.Errorf("encoding/json decoded %s to %+v %v, want %+v", encoded, unmarshaled, err, c)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	stream := string(AppendCommand(nil, CommandClear)) + string(AppendRead(nil, "abc")) +
+		string(AppendTime(nil, -1, -3600)) + string(AppendAction(nil, WidgetPomodoro, ActionToggle))
+	messages, errs := decode(&Decoder{}, stream)
+	if len(errs) != 0 || len(messages) != 4 {
+		t.Fatalf("decoded %q to %+v %v", stream, messages, errs)
+	}
+	if messages[0].Command != CommandClear || messages[1].Command != CommandRead || messages[1].Argument != "abc" {
+		t.Errorf("decoded %+v", messages[:2])
+	}
+	if unix, offset, ok := ParseTime(messages[2].Argument); !ok || unix != -1 || offset != -3600 {
+		t.Errorf("ParseTime(%q) = %d %d %t", messages[2].Argument, unix, offset, ok)
+	}
+	if kind, action, ok := ParseAction(messages[3].Argument); !ok || kind != WidgetPomodoro || action != ActionToggle {
+		t.Errorf("ParseAction(%q) = %q %q %t", messages[3].Argument, kind, action, ok)
+	}
+}
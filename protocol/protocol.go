@@ -0,0 +1,128 @@
+// Package protocol defines messages exchanged between daemon and Gopher Badge over serial port.
+// It is compiled by both Go and TinyGo, so it must not import machine, os or reflect.
+package protocol
+
+// Version is increased on every incompatible change of messages. Badge reports it in Capabilities.
+const Version = 1
+
+const (
+	CommandClear  = "clear"  // Removes all notifications from the badge.
+	CommandBye    = "bye"    // Tells the badge that host is going away.
+	CommandHello  = "hello"  // Asks the badge for its Capabilities.
+	CommandRead   = "read"   // Badge reports notification as read, with its ID as argument ("read:id").
+	CommandGroup  = "group"  // Groups badge history by program, with ArgumentOn or ArgumentOff ("group:on").
+	CommandDepth  = "depth"  // Sets number of notifications kept by badge, up to Capabilities.History ("depth:30").
+	CommandTime   = "time"   // Sets badge clock, with Unix time and UTC offset in seconds as argument ("time:1760000000,7200").
+	CommandAction = "action" // Badge reports button pressed on widget, with its kind and Action* ("action:pomodoro,toggle").
+)
+
+const (
+	ArgumentOn  = "on"
+	ArgumentOff = "off"
+)
+
+// ArgumentSeparator splits command from its argument.
+const ArgumentSeparator = ':'
+
+// TimeFormat is the layout of Notification.CreatedAt, in local time of host.
+const TimeFormat = "2006-01-02 15:04:05"
+
+// Notification is the message transmitted to Gopher Badge.
+// All fields are strings, because it's easier to unmarshal strings on badge side.
+type Notification struct {
+	ID        string `json:"id,omitempty"` // Assigned by daemon, unique across its restarts. Badge reports read state with it.
+	Program   string `json:"program,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Body      string `json:"body,omitempty"`
+	Sender    string `json:"sender,omitempty"`
+	Serial    string `json:"serial,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+	Icon      string `json:"icon,omitempty"`
+	Urgency   string `json:"urgency,omitempty"`  // One of Urgency* constants.
+	Sticky    string `json:"sticky,omitempty"`   // StickyTrue if badge must not evict notification for normal ones.
+	Color     string `json:"color,omitempty"`    // LED color as hex RGB, e.g. "ff0000".
+	Links     string `json:"links,omitempty"`    // Link targets found in body markup, separated by space.
+	Emphasis  string `json:"emphasis,omitempty"` // Emphasized parts of body, as "start-end" byte offsets separated by comma.
+	// Title and body rendered by daemon, as bitmap strips (see media.TextRenderer), for badges with Bitmap capability.
+	TitleBitmap string `json:"title_bitmap,omitempty"`
+	BodyBitmap  string `json:"body_bitmap,omitempty"`
+	// IconPath is used by daemon only and never transmitted. Icon file is converted to Icon when notification
+	// is sent, so notifications dropped by throttle don't pay for it.
+	IconPath string `json:"-"`
+}
+
+const (
+	UrgencyLow      = "low"
+	UrgencyNormal   = "normal"
+	UrgencyCritical = "critical"
+	StickyTrue      = "true"
+)
+
+// Pinned reports whether notification stays in badge history until it's deleted on the badge.
+// Critical notifications are always pinned, others if daemon marked them sticky.
+func (n *Notification) Pinned() bool {
+	return n.Sticky == StickyTrue || n.Urgency == UrgencyCritical
+}
+
+// Widget is data of a badge screen other than notification history, sent by daemon's widget providers.
+// Like Notification, all fields are strings, and only fields of its Kind are used.
+type Widget struct {
+	Kind string `json:"widget"` // One of Widget* constants. Always encoded first, it tells widget from notification.
+	// WidgetPlaying.
+	Player string `json:"player,omitempty"`
+	Status string `json:"status,omitempty"` // One of Status* constants, also used by WidgetPomodoro.
+	Title  string `json:"title,omitempty"`
+	Artist string `json:"artist,omitempty"`
+	Album  string `json:"album,omitempty"`
+	Art    string `json:"art,omitempty"`    // Album art, ArtSize pixels square, in the same format as Notification.Icon.
+	ArtID  string `json:"art_id,omitempty"` // Identifies Art. Art is sent once per ArtID, badge keeps it while ArtID stays.
+	// WidgetStats.
+	CPU    string `json:"cpu,omitempty"`    // Percent.
+	Memory string `json:"memory,omitempty"` // Percent.
+	Load   string `json:"load,omitempty"`   // One minute load average.
+	Uptime string `json:"uptime,omitempty"` // E.g. "3d 4h".
+	// WidgetPomodoro.
+	Phase     string `json:"phase,omitempty"`     // One of Phase* constants.
+	Remaining string `json:"remaining,omitempty"` // Seconds left in phase, badge counts them down while running.
+	Round     string `json:"round,omitempty"`     // Work phases completed.
+}
+
+const (
+	WidgetPlaying  = "playing"
+	WidgetStats    = "stats"
+	WidgetPomodoro = "pomodoro"
+)
+
+// ArtSize is width and height of Widget.Art in pixels.
+const ArtSize = 32
+
+const (
+	StatusRunning = "running" // Playing, for WidgetPlaying.
+	StatusPaused  = "paused"
+	StatusStopped = "stopped"
+	PhaseWork     = "work"
+	PhaseBreak    = "break"
+)
+
+// Actions are reported by the badge with CommandAction, for buttons pressed on widget.
+const (
+	ActionToggle   = "toggle"   // Button A, e.g. play or pause.
+	ActionStop     = "stop"     // Button B.
+	ActionPrevious = "previous" // Button Left.
+	ActionNext     = "next"     // Button Right.
+)
+
+// Capabilities are reported by the badge when daemon connects.
+// Badges which don't reply are assumed to have only ASCII font.
+type Capabilities struct {
+	Version int      `json:"version,omitempty"` // Protocol version of the badge, 0 for badges older than Version 1.
+	Charset string   `json:"charset,omitempty"` // One of Charset* constants.
+	Bitmap  bool     `json:"bitmap,omitempty"`  // Can show text rendered by daemon.
+	History int      `json:"history,omitempty"` // Maximum history depth, 0 for badges with fixed depth of 10.
+	Widgets []string `json:"widgets,omitempty"` // Widget* kinds badge can show.
+}
+
+const (
+	CharsetASCII = "ascii" // Printable ASCII only, everything else is transliterated.
+	CharsetUTF8  = "utf-8"
+)